@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"kcl-lang.io/helm-kcl/pkg/app"
+)
+
+// NewCacheCmd returns the cache command.
+func NewCacheCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:          "cache",
+		Short:        "Manage the cache of downloaded charts and repository index files",
+		SilenceUsage: true,
+	}
+	cmd.AddCommand(NewCacheCleanCmd())
+	return cmd
+}
+
+// NewCacheCleanCmd returns the cache clean command.
+func NewCacheCleanCmd() *cobra.Command {
+	var cacheDir string
+
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Remove the downloaded charts and repository index files from the cache",
+		RunE: func(*cobra.Command, []string) error {
+			return app.New().CleanCache(cacheDir)
+		},
+		SilenceUsage: true,
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&cacheDir, "cache-dir", "", "directory of the downloaded charts and repository index files. Default: $HELM_CACHE_HOME/kcl")
+
+	return cmd
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"kcl-lang.io/helm-kcl/pkg/app"
+	"kcl-lang.io/helm-kcl/pkg/config"
+)
+
+// NewLintCmd returns the lint command.
+func NewLintCmd() *cobra.Command {
+	lintOptions := config.NewLintOptions()
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Lint the KCL state file, the charts of its releases and its KCL source",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return app.New().Lint(config.NewLintImpl(lintOptions), cmd.OutOrStdout())
+		},
+		SilenceUsage: true,
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&lintOptions.File, "file", "", "input kcl file to pass to helm kcl lint")
+	f.StringVarP(&lintOptions.Output, "output", "o", config.LintOutputText, `output format of the problems, "text" or "json"`)
+	f.StringVar(&lintOptions.CacheDir, "cache-dir", "", "directory of the downloaded charts and repository index files. Default: $HELM_CACHE_HOME/kcl")
+
+	return cmd
+}
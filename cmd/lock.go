@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"kcl-lang.io/helm-kcl/pkg/app"
+	"kcl-lang.io/helm-kcl/pkg/config"
+)
+
+// NewLockCmd returns the lock command.
+func NewLockCmd() *cobra.Command {
+	lockOptions := config.NewLockOptions()
+
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Lock the chart versions and digests of the releases defined in the KCL state file",
+		RunE: func(*cobra.Command, []string) error {
+			return app.New().Lock(config.NewLockImpl(lockOptions))
+		},
+		SilenceUsage: true,
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&lockOptions.File, "file", "", "input kcl file to pass to helm kcl lock")
+	f.StringVar(&lockOptions.CacheDir, "cache-dir", "", "directory of the downloaded charts and repository index files. Default: $HELM_CACHE_HOME/kcl")
+
+	return cmd
+}
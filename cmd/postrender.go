@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"kcl-lang.io/helm-kcl/pkg/app"
+	"kcl-lang.io/helm-kcl/pkg/config"
+)
+
+const postRenderCmdLongUsage = `
+Read the manifests rendered by Helm from stdin, transform them with the KCL
+function config of the file and write the result to stdout.
+
+Use it as a Helm post renderer:
+
+	helm install my-release ./chart --post-renderer helm \
+		--post-renderer-args kcl --post-renderer-args post-render \
+		--post-renderer-args --file=./kcl-run.yaml
+`
+
+// NewPostRenderCmd returns the post-render command.
+func NewPostRenderCmd() *cobra.Command {
+	postRenderOptions := config.NewPostRenderOptions()
+
+	cmd := &cobra.Command{
+		Use:   "post-render",
+		Short: "Transform the manifests of stdin with the KCL state file, usable as a Helm post renderer",
+		Long:  postRenderCmdLongUsage,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return app.New().PostRender(config.NewPostRenderImpl(postRenderOptions), cmd.InOrStdin(), cmd.OutOrStdout())
+		},
+		SilenceUsage: true,
+	}
+
+	f := cmd.Flags()
+	f.StringVar(&postRenderOptions.File, "file", "", "input kcl file to pass to helm kcl post-render")
+
+	return cmd
+}
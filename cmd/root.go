@@ -21,6 +21,10 @@ func New() *cobra.Command {
 
 	cmd.AddCommand(NewVersionCmd())
 	cmd.AddCommand(NewTemplateCmd())
+	cmd.AddCommand(NewLockCmd())
+	cmd.AddCommand(NewCacheCmd())
+	cmd.AddCommand(NewPostRenderCmd())
+	cmd.AddCommand(NewLintCmd())
 	cmd.SetHelpCommand(&cobra.Command{}) // Disable the help command
 	return cmd
 }
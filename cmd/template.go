@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"cmp"
+	"os"
+
 	"github.com/spf13/cobra"
 
 	"kcl-lang.io/helm-kcl/pkg/app"
 	"kcl-lang.io/helm-kcl/pkg/config"
+	"kcl-lang.io/helm-kcl/pkg/helm"
 )
 
 // NewTemplateCmd returns the template command.
@@ -31,14 +35,39 @@ func NewTemplateCmd() *cobra.Command {
 	f.StringVar(&templateOptions.OutputDir, "output-dir", "", "output directory to pass to helm template (helm template --output-dir)")
 	f.StringVar(&templateOptions.OutputDirTemplate, "output-dir-template", "", "go text template for generating the output directory. Default: {{ .OutputDir }}/{{ .State.BaseName }}-{{ .State.AbsPathSHA1 }}-{{ .Release.Name}}")
 	f.IntVar(&templateOptions.Concurrency, "concurrency", 0, "maximum number of concurrent helm processes to run, 0 is unlimited")
-	f.BoolVar(&templateOptions.Validate, "validate", false, "validate your manifests against the Kubernetes cluster you are currently pointing at. Note that this requires access to a Kubernetes cluster to obtain information necessary for validating, like the template of available API versions")
+	f.BoolVar(&templateOptions.Validate, "validate", false, "validate the manifests offline against the JSON schemas of --schema-location and the openAPIV3Schema of the rendered CRDs, or against the cluster with --validate-mode cluster")
+	f.StringVar(&templateOptions.ValidateMode, "validate-mode", config.ValidateModeOffline, `how to validate the manifests: "offline" against JSON schemas, or "cluster" with the API versions and a server-side dry run of the cluster of --kube-context`)
+	// Helm consumes --kube-context and --kubeconfig itself when running plugins and
+	// exports them as HELM_KUBECONTEXT and KUBECONFIG.
+	f.StringVar(&templateOptions.KubeContext, "kube-context", cmp.Or(os.Getenv("HELM_KUBECONTEXT"), app.DefaultKubeContext), "name of the kubeconfig context to use for --validate-mode cluster")
+	f.StringVar(&templateOptions.Kubeconfig, "kubeconfig", "", "path to the kubeconfig file to use for --validate-mode cluster. Default: $KUBECONFIG or ~/.kube/config")
+	f.StringArrayVar(&templateOptions.SchemaLocations, "schema-location", nil, "directory of Kubernetes JSON schemas laid out as github.com/yannh/kubernetes-json-schema, or a go template of the schema files with the fields NormalizedKubernetesVersion, ResourceKind, ResourceAPIVersion, Group and KindSuffix (can specify multiple)")
+	f.BoolVar(&templateOptions.IgnoreMissingSchemas, "ignore-missing-schemas", false, "skip the validation of the resources without schema")
 	f.BoolVar(&templateOptions.IncludeCRDs, "include-crds", false, "include CRDs in the templated output")
+	f.BoolVar(&templateOptions.CRDsOnly, "crds-only", false, "only output the CRDs of the charts and their subcharts")
 	f.BoolVar(&templateOptions.SkipTests, "skip-tests", false, "skip tests from templated output")
+	f.BoolVar(&templateOptions.NoHooks, "no-hooks", false, "exclude hooks such as pre-install jobs and test pods from templated output")
+	f.StringArrayVarP(&templateOptions.Selectors, "selector", "l", nil, `only template the releases matching the labels, e.g. --selector tier=backend,name!=db. The implicit labels name, namespace and chart are set on every release. A release is templated when it matches any of the repeated --selector/-l flags`)
 	f.BoolVar(&templateOptions.SkipNeeds, "skip-needs", true, `do not automatically include releases from the target release's "needs" when --selector/-l flag is provided. Does nothing when --selector/-l flag is not provided. Defaults to true when --include-needs or --include-transitive-needs is not provided`)
 	f.BoolVar(&templateOptions.IncludeNeeds, "include-needs", false, `automatically include releases from the target release's "needs" when --selector/-l flag is provided. Does nothing when --selector/-l flag is not provided`)
 	f.BoolVar(&templateOptions.IncludeTransitiveNeeds, "include-transitive-needs", false, `like --include-needs, but also includes transitive needs (needs of needs). Does nothing when --selector/-l flag is not provided. Overrides exclusions of other selectors and conditions.`)
-	f.BoolVar(&templateOptions.SkipDeps, "skip-deps", false, `skip running "helm repo update" and "helm dependency build"`)
-	f.StringVar(&templateOptions.PostRenderer, "post-renderer", "", `pass --post-renderer to "helm template" or "helm upgrade --install"`)
+	f.BoolVar(&templateOptions.SkipDeps, "skip-deps", false, `skip running "helm repo update" and "helm dependency build" for the local chart directories`)
+	f.StringVar(&templateOptions.PostRenderer, "post-renderer", "", "the path to an executable to be used for post rendering. If it exists in $PATH, the binary will be used, otherwise it will try to look for the executable at the given path")
+	f.StringArrayVar(&templateOptions.PostRendererArgs, "post-renderer-args", nil, "an argument to the post-renderer (can specify multiple)")
+	f.StringVar(&templateOptions.PostRendererStage, "post-renderer-stage", config.PostRendererBeforeKCL, `when to run the post-renderer, "before" or "after" the KCL transformation`)
+	// Helm consumes --namespace itself when running plugins and exports it as HELM_NAMESPACE.
+	f.StringVar(&templateOptions.Namespace, "namespace", os.Getenv("HELM_NAMESPACE"), "namespace of the releases that do not set one in the KCL state file")
+	f.StringVar(&templateOptions.KubeVersion, "kube-version", "", "kubernetes version used for Capabilities.KubeVersion")
+	f.StringSliceVar(&templateOptions.APIVersions, "api-versions", nil, "kubernetes api versions used for Capabilities.APIVersions")
+	f.StringVar(&templateOptions.CacheDir, "cache-dir", "", "directory of the downloaded charts and repository index files. Default: $HELM_CACHE_HOME/kcl")
+	f.DurationVar(&templateOptions.IndexTTL, "index-ttl", helm.DefaultIndexTTL, "how long a cached repository index file or unversioned chart archive is used before being fetched again")
+	f.BoolVar(&templateOptions.Offline, "offline", false, "only use the cached charts and index files, failing if anything is missing")
+	f.BoolVar(&templateOptions.IgnoreLock, "ignore-lock", false, "resolve the charts again instead of using the versions and digests of the lock file written by helm kcl lock")
+	f.BoolVar(&templateOptions.Annotate, "annotate", false, "annotate the items with their release, chart and source template in helm-kcl.dev/release, helm-kcl.dev/chart and helm-kcl.dev/source before the KCL transformation")
+	f.BoolVar(&templateOptions.StripAnnotations, "strip-annotations", false, "remove the annotations added by --annotate from the output")
+	f.BoolVar(&templateOptions.Combined, "combined", false, "run the KCL transformation once over the items of all the releases instead of once per release")
+	f.BoolVar(&templateOptions.Verify, "verify", false, "verify the provenance of the chart archives before rendering them")
+	f.StringVar(&templateOptions.Keyring, "keyring", helm.DefaultKeyring(), "location of the public keys used for verification")
 
 	return cmd
 }
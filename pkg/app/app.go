@@ -1,15 +1,18 @@
 package app
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"net/url"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v2"
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/postrender"
 	"kcl-lang.io/helm-kcl/pkg/config"
 	"kcl-lang.io/helm-kcl/pkg/helm"
 	"kcl-lang.io/krm-kcl/pkg/kube"
@@ -20,6 +23,11 @@ type App struct {
 	helmBinary string
 	logger     *zap.SugaredLogger
 	render     helm.Render
+	// postRenderer runs on the items of every release, nil when unset.
+	postRenderer postrender.PostRenderer
+	// newClusterClient returns the client of the cluster of the kubeconfig and
+	// the kube context used to validate the manifests.
+	newClusterClient func(kubeconfig, kubeContext string) (clusterClient, error)
 }
 
 // Template of App run the
@@ -28,84 +36,471 @@ func (app *App) Template(templateImpl *config.TemplateImpl) error {
 	if err != nil {
 		return err
 	}
-	for _, repo := range kclRun.Repositories {
-		path, err := app.chartPathFromRepo(templateImpl.File, repo)
+	app.render.Cache = helm.NewCache(templateImpl.CacheDir(), templateImpl.IndexTTL(), templateImpl.Offline())
+	app.postRenderer, err = newPostRenderer(templateImpl)
+	if err != nil {
+		return err
+	}
+	// KCL function config
+	fnCfg, err := os.ReadFile(templateImpl.File)
+	if err != nil {
+		return err
+	}
+	var lock *config.LockFile
+	if !templateImpl.IgnoreLock() {
+		lock, err = config.LockFromFile(config.LockFilePath(templateImpl.File))
 		if err != nil {
 			return err
 		}
-		if err := app.template(templateImpl.File, repo.Name, path); err != nil {
+	}
+	// Values files from the command line are read only once because "-" means stdin.
+	cliValues, err := app.render.ReadValuesFiles(templateImpl.Values())
+	if err != nil {
+		return err
+	}
+	if err := checkNeeds(kclRun.Repositories); err != nil {
+		return err
+	}
+	repos, err := app.selectRepos(templateImpl, kclRun.Repositories)
+	if err != nil {
+		return err
+	}
+	// Releases are output level by level, after the releases they need.
+	var errs []error
+	var releases []*release
+	for _, level := range levelsByNeeds(repos) {
+		for _, repo := range level {
+			r, err := app.releaseFromRepo(templateImpl, repo, cliValues, lock)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("release %q: %w", repo.Name, err))
+			}
+			releases = append(releases, r)
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	var cluster clusterClient
+	if templateImpl.Validate() {
+		switch templateImpl.ValidateMode() {
+		case config.ValidateModeOffline:
+		case config.ValidateModeCluster:
+			cluster, err = app.newClusterClient(templateImpl.Kubeconfig(), templateImpl.KubeContext())
+			if err != nil {
+				return err
+			}
+			if err := discoverCapabilities(cluster, releases); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid validate mode %q, it should be %q or %q",
+				templateImpl.ValidateMode(), config.ValidateModeOffline, config.ValidateModeCluster)
+		}
+	}
+	// Charts are loaded before rendering so that every release can read the
+	// metadata of the others.
+	err = runConcurrently(len(releases), templateImpl.Concurrency(), func(i int) error {
+		r := releases[i]
+		ch, err := app.render.LoadLockedChart(r.source, r.lock)
+		if err != nil {
+			return fmt.Errorf("release %q: %w", r.opts.Name, err)
+		}
+		r.chart = ch
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	params := releasesParams(releases)
+	results := make([]kube.KubeObjects, len(releases))
+	// Rendering a release does not depend on the others, all of them are
+	// rendered at once and all their errors are reported.
+	err = runConcurrently(len(releases), templateImpl.Concurrency(), func(i int) error {
+		r := releases[i]
+		items, err := app.renderRelease(templateImpl, r)
+		if err == nil && !templateImpl.Combined() {
+			items, err = app.transform(templateImpl, items, fnCfg, map[string]interface{}{
+				"release":  params[r.opts.Name],
+				"releases": params,
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("release %q: %w", r.opts.Name, err)
+		}
+		results[i] = items
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if templateImpl.Combined() {
+		results, err = app.transformCombined(templateImpl, releases, results, fnCfg, params)
+		if err != nil {
 			return err
 		}
 	}
-	return nil
-}
-
-func (app *App) chartPathFromRepo(file string, repo config.RepositorySpec) (path string, err error) {
-	if repo.URL != "" {
-		path = repo.URL
-	} else if repo.Path != "" {
-		path = repo.Path
-		if !filepath.IsAbs(repo.Path) {
-			path = filepath.Join(filepath.Dir(file), repo.Path)
+	if cluster != nil {
+		if err := validateCluster(context.TODO(), cluster, releases, results); err != nil {
+			return err
+		}
+	} else if templateImpl.Validate() {
+		if err := app.validate(templateImpl, releases, results); err != nil {
+			return err
 		}
-	} else {
-		return "", errors.New("no valid helm chart path, it should be from a local path or a url")
 	}
-	return path, nil
+	for i, r := range releases {
+		if err := app.output(templateImpl, r, results[i]); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (app *App) template(kclRunFile, release, chartPath string) error {
-	// Generate Kubernetes manifests from helm charts.
-	manifests, err := app.renderManifests(release, chartPath)
+// PostRender transforms the manifests read from in with the KCL function
+// config of the file and writes the result to out.
+func (app *App) PostRender(postRenderImpl *config.PostRenderImpl, in io.Reader, out io.Writer) error {
+	fnCfg, err := os.ReadFile(postRenderImpl.File)
 	if err != nil {
 		return err
 	}
-	// KCL function config
-	fnCfg, err := os.ReadFile(kclRunFile)
+	manifests, err := io.ReadAll(in)
 	if err != nil {
 		return err
 	}
-	result, err := app.doMutate(manifests, fnCfg)
+	items, err := kube.ParseKubeObjects(manifests)
 	if err != nil {
 		return err
 	}
-	fmt.Println(result)
-	return nil
+	items, err = app.doMutate(items, fnCfg, nil)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	_, err = fmt.Fprintln(out, items.MustString())
+	return err
 }
 
-// Generate Kubernetes manifests from helm charts.
-func (app *App) renderManifests(release, chartPath string) ([]byte, error) {
-	var chart *chart.Chart
-	_, err := url.Parse(chartPath)
-	// Load from url
+// Lock resolves the chart of every repository to an exact version, archive and
+// digest and writes them to the lock file next to the KCLRun file.
+func (app *App) Lock(lockImpl *config.LockImpl) error {
+	kclRun, err := config.FromFile(lockImpl.File)
 	if err != nil {
-		// Load from url
-		chart, err = app.render.LoadChartFromRemoteCharts(chartPath)
+		return err
+	}
+	// Index files are always fetched to lock the latest matching versions.
+	app.render.Cache = helm.NewCache(lockImpl.CacheDir(), 0, false)
+	var errs []error
+	lock := &config.LockFile{}
+	for _, repo := range kclRun.Repositories {
+		locked, err := app.lockRepo(lockImpl.File, repo)
 		if err != nil {
+			errs = append(errs, fmt.Errorf("release %q: %w", repo.Name, err))
+			continue
+		}
+		lock.Releases = append(lock.Releases, *locked)
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return lock.WriteFile(config.LockFilePath(lockImpl.File))
+}
+
+func (app *App) lockRepo(file string, repo config.RepositorySpec) (*config.LockedRelease, error) {
+	source, err := app.chartSourceFromRepo(file, repo)
+	if err != nil {
+		return nil, err
+	}
+	chartLock, err := app.render.LockChart(source)
+	if err != nil {
+		return nil, err
+	}
+	locked := &config.LockedRelease{
+		Name:       repo.Name,
+		URL:        repo.URL,
+		Path:       repo.Path,
+		Chart:      repo.Chart,
+		Constraint: repo.Version,
+	}
+	if chartLock != nil {
+		locked.Version = chartLock.Version
+		locked.ArchiveURL = chartLock.ArchiveURL
+		locked.Digest = chartLock.Digest
+	}
+	return locked, nil
+}
+
+// CleanCache removes the downloaded charts and index files from the cache dir.
+func (app *App) CleanCache(cacheDir string) error {
+	return helm.NewCache(cacheDir, 0, false).Clean()
+}
+
+// release is a repository of the KCL state file prepared for rendering.
+type release struct {
+	repo   config.RepositorySpec
+	opts   *helm.ReleaseOptions
+	source *helm.ChartSource
+	lock   *helm.ChartLock
+	values map[string]interface{}
+	chart  *chart.Chart
+}
+
+func (app *App) releaseFromRepo(templateImpl *config.TemplateImpl, repo config.RepositorySpec, cliValues map[string]interface{}, lockFile *config.LockFile) (*release, error) {
+	repo.Verify = repo.Verify || templateImpl.Verify()
+	source, err := app.chartSourceFromRepo(templateImpl.File, repo)
+	if err != nil {
+		return nil, err
+	}
+	if source.Keyring == "" {
+		source.Keyring = templateImpl.Keyring()
+	}
+	if !templateImpl.SkipDeps() {
+		if err := app.render.BuildDependencies(source); err != nil {
 			return nil, err
 		}
-	} else {
-		// Load from local path
-		chart, err = app.render.LoadChartFromLocalDirectory(chartPath)
-		if err != nil {
+	}
+	var lock *helm.ChartLock
+	if lockFile != nil {
+		locked := lockFile.Get(repo.Name)
+		if locked == nil || !locked.Matches(repo) {
+			return nil, fmt.Errorf("the lock file %s is out of date, run helm kcl lock to update it", config.LockFilePath(templateImpl.File))
+		}
+		if locked.Digest != "" {
+			lock = &helm.ChartLock{Version: locked.Version, ArchiveURL: locked.ArchiveURL, Digest: locked.Digest}
+		}
+	}
+	values, err := app.valuesFromRepo(templateImpl.File, repo, cliValues, templateImpl.Set())
+	if err != nil {
+		return nil, err
+	}
+	return &release{
+		repo:   repo,
+		opts:   app.releaseOptionsFromRepo(repo, templateImpl),
+		source: source,
+		lock:   lock,
+		values: values,
+	}, nil
+}
+
+// releasesParams returns the metadata of the releases keyed by name, as passed
+// to KCL in option("params").
+func releasesParams(releases []*release) map[string]interface{} {
+	params := make(map[string]interface{}, len(releases))
+	for _, r := range releases {
+		params[r.opts.Name] = map[string]interface{}{
+			"name":      r.opts.Name,
+			"namespace": r.opts.Namespace,
+			"chart":     r.chart.Metadata.Name,
+			"version":   r.chart.Metadata.Version,
+			"values":    r.values,
+		}
+	}
+	return params
+}
+
+// chartSourceFromRepo resolves the chart location of the repository, the
+// local paths being relative to the KCLRun file.
+func (app *App) chartSourceFromRepo(file string, repo config.RepositorySpec) (*helm.ChartSource, error) {
+	ref := &helm.ChartReference{
+		URL:        repo.URL,
+		Chart:      repo.Chart,
+		Version:    repo.Version,
+		OCI:        repo.OCI,
+		TLSOptions: tlsOptionsFromRepo(file, repo),
+		Verify:     repo.Verify,
+	}
+	if repo.Path != "" {
+		ref.Path = pathFromFile(file, repo.Path)
+	}
+	if repo.Keyring != "" {
+		ref.Keyring = pathFromFile(file, repo.Keyring)
+	}
+	return helm.ResolveChartSource(ref)
+}
+
+// valuesFromRepo merges the release values in order of increasing precedence:
+// the inline values, the values files and the set entries of the repository,
+// then the values files and the set entries from the command line.
+func (app *App) valuesFromRepo(file string, repo config.RepositorySpec, cliValues map[string]interface{}, cliSet []string) (map[string]interface{}, error) {
+	valuesFiles := make([]string, len(repo.ValuesFiles))
+	for i, valuesFile := range repo.ValuesFiles {
+		// Stdin is read once for all the releases, with --values - on the command line.
+		if valuesFile == "-" {
+			return nil, errors.New(`valuesFiles cannot read "-" from stdin, pass --values - on the command line instead`)
+		}
+		if strings.Contains(valuesFile, "://") {
+			valuesFiles[i] = valuesFile
+		} else {
+			valuesFiles[i] = pathFromFile(file, valuesFile)
+		}
+	}
+	fileValues, err := app.render.ReadValuesFiles(valuesFiles)
+	if err != nil {
+		return nil, err
+	}
+	values := helm.MergeValues(repo.Values, fileValues)
+	if err := app.render.SetValues(values, repo.Set); err != nil {
+		return nil, err
+	}
+	values = helm.MergeValues(values, cliValues)
+	if err := app.render.SetValues(values, cliSet); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// releaseOptionsFromRepo returns the render options of the release, the
+// repository settings taking precedence over the command line ones.
+func (app *App) releaseOptionsFromRepo(repo config.RepositorySpec, templateImpl *config.TemplateImpl) *helm.ReleaseOptions {
+	opts := &helm.ReleaseOptions{
+		Name:        repo.Name,
+		Namespace:   repo.Namespace,
+		KubeVersion: repo.KubeVersion,
+		APIVersions: append(append([]string{}, templateImpl.APIVersions()...), repo.APIVersions...),
+		IncludeCRDs: templateImpl.IncludeCRDs(),
+		CRDsOnly:    templateImpl.CRDsOnly(),
+		SkipTests:   templateImpl.SkipTests(),
+		NoHooks:     templateImpl.NoHooks(),
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = templateImpl.Namespace()
+	}
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultNamespace
+	}
+	if opts.KubeVersion == "" {
+		opts.KubeVersion = templateImpl.KubeVersion()
+	}
+	return opts
+}
+
+// tlsOptionsFromRepo returns the TLS and authentication settings of the
+// repository, the files being resolved relative to the KCLRun file.
+func tlsOptionsFromRepo(file string, repo config.RepositorySpec) *helm.TLSOptions {
+	opts := &helm.TLSOptions{
+		Username:              repo.Username,
+		Password:              repo.Password,
+		PassCredentials:       repo.PassCredentials,
+		InsecureSkipTLSVerify: repo.SkipTLSVerify,
+		PlainHTTP:             repo.PlainHTTP,
+	}
+	if repo.CaFile != "" {
+		opts.CaFile = pathFromFile(file, repo.CaFile)
+	}
+	if repo.CertFile != "" {
+		opts.CertFile = pathFromFile(file, repo.CertFile)
+	}
+	if repo.KeyFile != "" {
+		opts.KeyFile = pathFromFile(file, repo.KeyFile)
+	}
+	return opts
+}
+
+// pathFromFile resolves path relative to the directory of the KCLRun file.
+func pathFromFile(file, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(file), path)
+}
+
+// renderRelease renders the release into items, running the post renderer when it
+// runs before the KCL transformation.
+func (app *App) renderRelease(templateImpl *config.TemplateImpl, r *release) (kube.KubeObjects, error) {
+	// Generate Kubernetes manifests from helm charts.
+	manifests, err := app.render.GenerateManifests(r.opts, r.chart, r.values)
+	if err != nil {
+		return nil, err
+	}
+	// The source templates are also recorded to report validation errors per file.
+	items, err := parseManifests(manifests, writeToDir(templateImpl) || templateImpl.Annotate() || templateImpl.Validate())
+	if err != nil {
+		return nil, err
+	}
+	if templateImpl.Annotate() {
+		if err := annotateRelease(items, r); err != nil {
 			return nil, err
 		}
 	}
-	manifests, err := app.render.GenerateManifests(release, "default", chart, nil)
+	return app.postRender(templateImpl, config.PostRendererBeforeKCL, items)
+}
+
+// transform mutates the items with the KCL function config, running the post
+// renderer when it runs after the KCL transformation.
+func (app *App) transform(templateImpl *config.TemplateImpl, items kube.KubeObjects, fnCfg []byte, params map[string]interface{}) (kube.KubeObjects, error) {
+	items, err := app.doMutate(items, fnCfg, params)
 	if err != nil {
 		return nil, err
 	}
-	return manifests, nil
+	return app.postRender(templateImpl, config.PostRendererAfterKCL, items)
 }
 
-func (app *App) doMutate(manifests, fnCfg []byte) (string, error) {
-	items, err := kube.ParseKubeObjects(manifests)
+// transformCombined mutates the items of all the releases at once. The items
+// record their release in the ReleaseAnnotation so that they can be split back
+// by release afterwards, the items created by KCL going to the first release.
+// The annotation is removed on output unless the annotations are kept.
+func (app *App) transformCombined(templateImpl *config.TemplateImpl, releases []*release, results []kube.KubeObjects, fnCfg []byte, params map[string]interface{}) ([]kube.KubeObjects, error) {
+	if len(releases) == 0 {
+		return nil, errors.New("no release to template, --combined needs at least one release to output the items to")
+	}
+	var items kube.KubeObjects
+	for i, r := range releases {
+		for _, o := range results[i] {
+			if err := o.SetAnnotation(ReleaseAnnotation, r.opts.Name); err != nil {
+				return nil, err
+			}
+		}
+		items = append(items, results[i]...)
+	}
+	items, err := app.transform(templateImpl, items, fnCfg, map[string]interface{}{
+		"releases": params,
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	index := make(map[string]int, len(releases))
+	for i, r := range releases {
+		index[r.opts.Name] = i
+	}
+	split := make([]kube.KubeObjects, len(releases))
+	for _, o := range items {
+		i := index[o.GetAnnotation(ReleaseAnnotation)]
+		split[i] = append(split[i], o)
+	}
+	return split, nil
+}
+
+// output prints the items of the release or writes them to its output dir.
+func (app *App) output(templateImpl *config.TemplateImpl, r *release, items kube.KubeObjects) error {
+	keep := keepAnnotations(templateImpl)
+	if !keep {
+		if err := stripAnnotations(items, ReleaseAnnotation, ChartAnnotation); err != nil {
+			return err
+		}
+	}
+	if !writeToDir(templateImpl) {
+		if !keep {
+			if err := stripAnnotations(items, SourceAnnotation); err != nil {
+				return err
+			}
+		}
+		fmt.Println(items.MustString())
+		return nil
+	}
+	outputDir, err := outputDirFromTemplate(templateImpl, r.opts)
+	if err != nil {
+		return err
+	}
+	return writeManifests(outputDir, items, keep)
+}
+
+// doMutate transforms the items with the KCL function config, the params being
+// added to the spec.params read by KCL with option("params").
+func (app *App) doMutate(items kube.KubeObjects, fnCfg []byte, params map[string]interface{}) (kube.KubeObjects, error) {
 	functionConfig, err := kube.ParseKubeObject(fnCfg)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	// Construct resource list.
 	resourceList := &kube.ResourceList{
@@ -114,11 +509,17 @@ func (app *App) doMutate(manifests, fnCfg []byte) (string, error) {
 	}
 	r := &config.KCLRun{}
 	if err := yaml.Unmarshal(fnCfg, r); err != nil {
-		return "", err
+		return nil, err
+	}
+	if len(params) > 0 && r.Spec.Params == nil {
+		r.Spec.Params = make(map[string]interface{}, len(params))
+	}
+	for k, v := range params {
+		r.Spec.Params[k] = v
 	}
 	err = r.TransformResourceList(resourceList)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return resourceList.Items.MustString(), nil
+	return resourceList.Items, nil
 }
@@ -0,0 +1,114 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kcl-lang.io/helm-kcl/pkg/config"
+)
+
+func TestTransformCombinedWithoutReleases(t *testing.T) {
+	app := &App{}
+	templateImpl := config.NewTemplateImpl(&config.TemplateOptions{Combined: true})
+	results, err := app.transformCombined(templateImpl, nil, nil, nil, map[string]interface{}{})
+	if err == nil || !strings.Contains(err.Error(), "at least one release") {
+		t.Errorf("transformCombined() = %v, %v, want an error", results, err)
+	}
+}
+
+func TestValuesFromRepoStdin(t *testing.T) {
+	repo := config.RepositorySpec{Name: "app", Path: "./app", ValuesFiles: []string{"-"}}
+	_, err := (&App{}).valuesFromRepo("kcl-run.yaml", repo, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), `"-"`) {
+		t.Errorf("valuesFromRepo() error = %v, want stdin to be rejected", err)
+	}
+}
+
+// writeTestChart writes a chart named name with the template to dir.
+func writeTestChart(t *testing.T, dir, name, tmpl string) {
+	t.Helper()
+	files := map[string]string{
+		"Chart.yaml":               fmt.Sprintf("apiVersion: v2\nname: %s\nversion: 0.1.0\n", name),
+		"templates/configmap.yaml": tmpl,
+	}
+	for file, data := range files {
+		path := filepath.Join(dir, name, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTemplateReportsAllReleaseErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTestChart(t, dir, "db", `{{ fail "db is broken" }}`)
+	writeTestChart(t, dir, "api", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: api\n")
+	writeTestChart(t, dir, "web", `{{ fail "web is broken" }}`)
+	file := filepath.Join(dir, "kcl-run.yaml")
+	kclRun := `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+spec:
+  source: a = 1
+repositories:
+- name: web
+  path: ./web
+  needs: [api]
+- name: api
+  path: ./api
+  needs: [db]
+- name: db
+  path: ./db
+`
+	if err := os.WriteFile(file, []byte(kclRun), 0644); err != nil {
+		t.Fatal(err)
+	}
+	templateImpl := config.NewTemplateImpl(&config.TemplateOptions{File: file, CacheDir: t.TempDir(), IgnoreLock: true})
+	err := New().Template(templateImpl)
+	// The release of the last level is rendered even though the first one failed.
+	if err == nil || !strings.Contains(err.Error(), "db is broken") || !strings.Contains(err.Error(), "web is broken") {
+		t.Errorf("Template() error = %v, want the errors of db and web", err)
+	}
+}
+
+func TestTemplateStaleLock(t *testing.T) {
+	dir := t.TempDir()
+	writeTestChart(t, dir, "app", "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n")
+	file := filepath.Join(dir, "kcl-run.yaml")
+	kclRun := `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+spec:
+  source: a = 1
+repositories:
+- name: app
+  path: ./app
+`
+	if err := os.WriteFile(file, []byte(kclRun), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		releases []config.LockedRelease
+	}{
+		{name: "moved", releases: []config.LockedRelease{{Name: "app", Path: "./charts/app"}}},
+		{name: "missing", releases: []config.LockedRelease{{Name: "web", Path: "./app"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lock := &config.LockFile{Releases: tt.releases}
+			if err := lock.WriteFile(config.LockFilePath(file)); err != nil {
+				t.Fatal(err)
+			}
+			templateImpl := config.NewTemplateImpl(&config.TemplateOptions{File: file, CacheDir: t.TempDir()})
+			err := New().Template(templateImpl)
+			if err == nil || !strings.Contains(err.Error(), "is out of date") {
+				t.Errorf("Template() error = %v, want the lock file to be out of date", err)
+			}
+		})
+	}
+}
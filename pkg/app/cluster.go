@@ -0,0 +1,197 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/action"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+	"sigs.k8s.io/yaml"
+)
+
+// fieldManager is the field manager of the server-side dry run applies.
+const fieldManager = "helm-kcl"
+
+// clusterClient is the Kubernetes cluster the manifests are validated against.
+type clusterClient interface {
+	// ServerVersion returns the Kubernetes version of the cluster, e.g. v1.30.2.
+	ServerVersion() (string, error)
+	// APIVersions returns the group versions and the group version kinds served by the cluster.
+	APIVersions() ([]string, error)
+	// DryRun applies o server-side without persisting it, in namespace when o
+	// is namespaced and has none.
+	DryRun(ctx context.Context, o *kube.KubeObject, namespace string) error
+	// Served reports whether the cluster serves the kind of o.
+	Served(o *kube.KubeObject) bool
+}
+
+// kubeClusterClient is a clusterClient backed by the discovery and dynamic clients.
+type kubeClusterClient struct {
+	discovery discovery.DiscoveryInterface
+	dynamic   dynamic.Interface
+	mapper    meta.RESTMapper
+}
+
+// newKubeClusterClient returns the client of the kube context of the
+// kubeconfig, the default loading rules and the current context being used
+// when they are empty.
+func newKubeClusterClient(kubeconfig, kubeContext string) (clusterClient, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: kubeContext}
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the kubeconfig: %w", err)
+	}
+	return newKubeClusterClientForConfig(restConfig)
+}
+
+// newKubeClusterClientForConfig returns the client of the cluster of restConfig,
+// e.g. a local fake discovery server.
+func newKubeClusterClientForConfig(restConfig *rest.Config) (*kubeClusterClient, error) {
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	cached := memory.NewMemCacheClient(discoveryClient)
+	return &kubeClusterClient{
+		discovery: cached,
+		dynamic:   dynamicClient,
+		mapper:    restmapper.NewDeferredDiscoveryRESTMapper(cached),
+	}, nil
+}
+
+func (c *kubeClusterClient) ServerVersion() (string, error) {
+	info, err := c.discovery.ServerVersion()
+	if err != nil {
+		return "", fmt.Errorf("could not get the server version from Kubernetes: %w", err)
+	}
+	return info.GitVersion, nil
+}
+
+func (c *kubeClusterClient) APIVersions() ([]string, error) {
+	versions, err := action.GetVersionSet(c.discovery)
+	if err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+func (c *kubeClusterClient) Served(o *kube.KubeObject) bool {
+	gvk := schema.FromAPIVersionAndKind(o.GetAPIVersion(), o.GetKind())
+	_, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	return err == nil
+}
+
+func (c *kubeClusterClient) DryRun(ctx context.Context, o *kube.KubeObject, namespace string) error {
+	gvk := schema.FromAPIVersionAndKind(o.GetAPIVersion(), o.GetKind())
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return err
+	}
+	data, err := yaml.YAMLToJSON([]byte(o.MustString()))
+	if err != nil {
+		return err
+	}
+	u := &unstructured.Unstructured{}
+	if err := u.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	// The annotations recorded by helm-kcl are not part of what is validated.
+	annotations := u.GetAnnotations()
+	for key := range annotations {
+		if strings.HasPrefix(key, annotationPrefix) {
+			delete(annotations, key)
+		}
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	u.SetAnnotations(annotations)
+	var resource dynamic.ResourceInterface = c.dynamic.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		if u.GetNamespace() == "" {
+			u.SetNamespace(namespace)
+		}
+		resource = c.dynamic.Resource(mapping.Resource).Namespace(u.GetNamespace())
+	}
+	_, err = resource.Apply(ctx, u.GetName(), u, metav1.ApplyOptions{
+		FieldManager: fieldManager,
+		DryRun:       []string{metav1.DryRunAll},
+		Force:        true,
+	})
+	return err
+}
+
+// discoverCapabilities sets the kube version of the cluster on the releases
+// which do not set one and adds the API versions it serves to all of them.
+func discoverCapabilities(client clusterClient, releases []*release) error {
+	kubeVersion, err := client.ServerVersion()
+	if err != nil {
+		return err
+	}
+	apiVersions, err := client.APIVersions()
+	if err != nil {
+		return err
+	}
+	for _, r := range releases {
+		if r.opts.KubeVersion == "" {
+			r.opts.KubeVersion = kubeVersion
+		}
+		r.opts.APIVersions = append(r.opts.APIVersions, apiVersions...)
+	}
+	return nil
+}
+
+// validateCluster validates the items of every release with a server-side dry
+// run. The custom resources whose CRD is not installed yet but rendered by a
+// release cannot be validated by the cluster and are skipped.
+func validateCluster(ctx context.Context, client clusterClient, releases []*release, results []kube.KubeObjects) error {
+	rendered := map[string]bool{}
+	for _, items := range results {
+		for _, o := range items {
+			if o.GetKind() == "CustomResourceDefinition" {
+				var crd struct {
+					Spec struct {
+						Group string `json:"group"`
+						Names struct {
+							Kind string `json:"kind"`
+						} `json:"names"`
+					} `json:"spec"`
+				}
+				if err := yaml.Unmarshal([]byte(o.MustString()), &crd); err == nil {
+					rendered[crd.Spec.Group+"/"+crd.Spec.Names.Kind] = true
+				}
+			}
+		}
+	}
+	var errs []error
+	for i, r := range releases {
+		for _, o := range results[i] {
+			gvk := schema.FromAPIVersionAndKind(o.GetAPIVersion(), o.GetKind())
+			if rendered[gvk.Group+"/"+gvk.Kind] && !client.Served(o) {
+				continue
+			}
+			if err := client.DryRun(ctx, o, r.opts.Namespace); err != nil {
+				errs = append(errs, fmt.Errorf("release %q: %s: %w", r.opts.Name, describeObject(o), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
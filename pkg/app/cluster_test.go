@@ -0,0 +1,213 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+	"kcl-lang.io/helm-kcl/pkg/helm"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+)
+
+// testCluster is a fake API server serving the discovery endpoints and the
+// server-side applies of ConfigMaps and CRDs. The applies of the ConfigMaps
+// named invalid are rejected.
+type testCluster struct {
+	applied []string
+	bodies  []string
+}
+
+func (c *testCluster) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var body interface{}
+	switch req.URL.Path {
+	case "/version":
+		body = map[string]string{"major": "1", "minor": "30", "gitVersion": "v1.30.2"}
+	case "/api":
+		body = map[string]interface{}{"kind": "APIVersions", "versions": []string{"v1"}}
+	case "/api/v1":
+		body = map[string]interface{}{
+			"kind":         "APIResourceList",
+			"groupVersion": "v1",
+			"resources": []map[string]interface{}{
+				{"name": "configmaps", "kind": "ConfigMap", "namespaced": true, "verbs": []string{"get", "patch"}},
+			},
+		}
+	case "/apis":
+		body = map[string]interface{}{
+			"kind": "APIGroupList",
+			"groups": []map[string]interface{}{{
+				"name":             "apiextensions.k8s.io",
+				"versions":         []map[string]string{{"groupVersion": "apiextensions.k8s.io/v1", "version": "v1"}},
+				"preferredVersion": map[string]string{"groupVersion": "apiextensions.k8s.io/v1", "version": "v1"},
+			}},
+		}
+	case "/apis/apiextensions.k8s.io/v1":
+		body = map[string]interface{}{
+			"kind":         "APIResourceList",
+			"groupVersion": "apiextensions.k8s.io/v1",
+			"resources": []map[string]interface{}{
+				{"name": "customresourcedefinitions", "kind": "CustomResourceDefinition", "verbs": []string{"get", "patch"}},
+			},
+		}
+	default:
+		if req.Method != http.MethodPatch || req.URL.Query().Get("dryRun") != "All" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		data, _ := io.ReadAll(req.Body)
+		c.applied = append(c.applied, req.URL.Path)
+		c.bodies = append(c.bodies, string(data))
+		if strings.HasSuffix(req.URL.Path, "/invalid") {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			body = map[string]interface{}{
+				"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "Invalid", "code": 422,
+				"message": `ConfigMap "invalid" is invalid: data: Invalid value`,
+			}
+			break
+		}
+		_, _ = w.Write(data)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func newTestClusterClient(t *testing.T) (*testCluster, clusterClient) {
+	t.Helper()
+	cluster := &testCluster{}
+	server := httptest.NewServer(cluster)
+	t.Cleanup(server.Close)
+	client, err := newKubeClusterClientForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cluster, client
+}
+
+func mustParseKubeObjects(t *testing.T, manifests string) kube.KubeObjects {
+	t.Helper()
+	items, err := kube.ParseKubeObjects([]byte(manifests))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return items
+}
+
+func TestDiscoverCapabilities(t *testing.T) {
+	_, client := newTestClusterClient(t)
+	releases := []*release{
+		{opts: &helm.ReleaseOptions{Name: "discovered"}},
+		{opts: &helm.ReleaseOptions{Name: "pinned", KubeVersion: "v1.28.0", APIVersions: []string{"example.com/v1"}}},
+	}
+	if err := discoverCapabilities(client, releases); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		release     *release
+		kubeVersion string
+		apiVersions []string
+	}{
+		{
+			release:     releases[0],
+			kubeVersion: "v1.30.2",
+			apiVersions: []string{"v1", "v1/ConfigMap", "apiextensions.k8s.io/v1", "apiextensions.k8s.io/v1/CustomResourceDefinition"},
+		},
+		{
+			release:     releases[1],
+			kubeVersion: "v1.28.0",
+			apiVersions: []string{"example.com/v1", "v1", "apiextensions.k8s.io/v1/CustomResourceDefinition"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.release.opts.Name, func(t *testing.T) {
+			if got := tt.release.opts.KubeVersion; got != tt.kubeVersion {
+				t.Errorf("KubeVersion = %q, want %q", got, tt.kubeVersion)
+			}
+			for _, v := range tt.apiVersions {
+				if !slices.Contains(tt.release.opts.APIVersions, v) {
+					t.Errorf("APIVersions = %v, missing %q", tt.release.opts.APIVersions, v)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateCluster(t *testing.T) {
+	cluster, client := newTestClusterClient(t)
+	releases := []*release{
+		{opts: &helm.ReleaseOptions{Name: "app", Namespace: "default"}},
+		{opts: &helm.ReleaseOptions{Name: "widgets", Namespace: "widgets"}},
+	}
+	results := []kube.KubeObjects{
+		mustParseKubeObjects(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: valid
+  annotations:
+    helm-kcl.dev/source: app/templates/valid.yaml
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: invalid
+  namespace: other
+`),
+		mustParseKubeObjects(t, `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+`),
+	}
+
+	err := validateCluster(context.Background(), client, releases, results)
+	if err == nil {
+		t.Fatal("expected the invalid ConfigMap to be reported")
+	}
+	want := `release "app": ConfigMap other/invalid: ConfigMap "invalid" is invalid: data: Invalid value`
+	if err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+	wantApplied := []string{
+		"/api/v1/namespaces/default/configmaps/valid",
+		"/api/v1/namespaces/other/configmaps/invalid",
+		"/apis/apiextensions.k8s.io/v1/customresourcedefinitions/widgets.example.com",
+	}
+	if !slices.Equal(cluster.applied, wantApplied) {
+		t.Errorf("applied = %v, want %v", cluster.applied, wantApplied)
+	}
+	for _, body := range cluster.bodies {
+		if strings.Contains(body, annotationPrefix) || strings.Contains(body, `"annotations"`) {
+			t.Errorf("the helm-kcl annotations were applied: %s", body)
+		}
+	}
+}
+
+func TestValidateClusterUnservedCustomResource(t *testing.T) {
+	_, client := newTestClusterClient(t)
+	releases := []*release{{opts: &helm.ReleaseOptions{Name: "widgets"}}}
+	// Without its CRD rendered, an unserved custom resource is an error.
+	results := []kube.KubeObjects{mustParseKubeObjects(t, `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+`)}
+	err := validateCluster(context.Background(), client, releases, results)
+	if err == nil || !strings.Contains(err.Error(), `release "widgets": Widget widget: `) {
+		t.Errorf("error = %v, want the unserved Widget reported", err)
+	}
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"errors"
+	"sync"
+)
+
+// runConcurrently calls fn for every index in [0, n) with at most concurrency
+// calls in flight, 0 or less meaning unlimited. It waits for all the calls and
+// returns their errors joined in index order.
+func runConcurrently(n, concurrency int, fn func(i int) error) error {
+	if concurrency <= 0 || concurrency > n {
+		concurrency = n
+	}
+	errs := make([]error, n)
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
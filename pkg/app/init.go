@@ -11,6 +11,8 @@ import (
 const (
 	DefaultHelmBinary             = "helm"
 	DefaultKubeContext            = ""
+	DefaultNamespace              = "default"
+	DefaultOutputDirTemplate      = "{{ .OutputDir }}/{{ .State.BaseName }}-{{ .State.AbsPathSHA1 }}-{{ .Release.Name }}"
 	HelmRequiredVersion           = "v3.10.3"
 	HelmRecommendedVersion        = "v3.11.2"
 	HelmDiffRecommendedVersion    = "v3.4.0"
@@ -57,5 +59,5 @@ type helmRecommendedPlugin struct {
 }
 
 func New() *App {
-	return &App{helmBinary: DefaultHelmBinary, logger: NewLogger(os.Stdout, "debug"), render: helm.Render{}}
+	return &App{helmBinary: DefaultHelmBinary, logger: NewLogger(os.Stdout, "debug"), render: helm.Render{}, newClusterClient: newKubeClusterClient}
 }
@@ -0,0 +1,229 @@
+package app
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/lint/support"
+	"kcl-lang.io/helm-kcl/pkg/config"
+	"kcl-lang.io/helm-kcl/pkg/helm"
+	kcl "kcl-lang.io/kcl-go"
+)
+
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+	lintInfo    = "info"
+)
+
+// lintProblem is a problem found by the lint command.
+type lintProblem struct {
+	File string `json:"file"`
+	config.Position
+	Release  string `json:"release,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// String formats the problem as file:line:column: severity: message.
+func (p *lintProblem) String() string {
+	location := p.File
+	if p.Line > 0 {
+		location += fmt.Sprintf(":%d", p.Line)
+		if p.Column > 0 {
+			location += fmt.Sprintf(":%d", p.Column)
+		}
+	}
+	message := p.Message
+	if p.Release != "" {
+		message = fmt.Sprintf("release %q: %s", p.Release, message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, p.Severity, message)
+}
+
+// Lint checks that the KCLRun file is valid, that the chart of every
+// repository resolves and passes the Helm chart linter and that the KCL source
+// compiles, without rendering anything. The problems are written to out and an
+// error is returned when any of them is an error.
+func (app *App) Lint(lintImpl *config.LintImpl, out io.Writer) error {
+	switch lintImpl.Output() {
+	case config.LintOutputText, config.LintOutputJSON:
+	default:
+		return fmt.Errorf("invalid output %q, it should be %q or %q", lintImpl.Output(), config.LintOutputText, config.LintOutputJSON)
+	}
+	problems := app.lint(lintImpl)
+	if lintImpl.Output() == config.LintOutputJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if problems == nil {
+			problems = []lintProblem{}
+		}
+		if err := encoder.Encode(problems); err != nil {
+			return err
+		}
+	} else {
+		for _, p := range problems {
+			fmt.Fprintln(out, p.String())
+		}
+	}
+	errs := 0
+	for _, p := range problems {
+		if p.Severity == lintError {
+			errs++
+		}
+	}
+	if errs > 0 {
+		return fmt.Errorf("%s: %d error(s) found", lintImpl.File, errs)
+	}
+	return nil
+}
+
+func (app *App) lint(lintImpl *config.LintImpl) []lintProblem {
+	file := lintImpl.File
+	kclRun, err := config.FromFile(file)
+	if err != nil {
+		return problemsFromError(file, err)
+	}
+	positions, err := config.PositionsFromFile(file)
+	if err != nil {
+		return []lintProblem{{File: file, Severity: lintError, Message: err.Error()}}
+	}
+	app.render.Cache = helm.NewCache(lintImpl.CacheDir(), helm.DefaultIndexTTL, false)
+	var problems []lintProblem
+	for i, repo := range kclRun.Repositories {
+		problems = append(problems, app.lintRepo(file, repo, positions.Repository(i))...)
+	}
+	return append(problems, lintSource(file, kclRun.Spec.Source, positions)...)
+}
+
+// problemsFromError returns a problem for every error joined in err, at the
+// position of the field errors of the KCLRun file.
+func problemsFromError(file string, err error) []lintProblem {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var problems []lintProblem
+		for _, err := range joined.Unwrap() {
+			problems = append(problems, problemsFromError(file, err)...)
+		}
+		return problems
+	}
+	var fieldErr *config.FieldError
+	if errors.As(err, &fieldErr) {
+		return []lintProblem{{File: fieldErr.File, Position: fieldErr.Position, Severity: lintError, Message: fieldErr.Message}}
+	}
+	return []lintProblem{{File: file, Severity: lintError, Message: err.Error()}}
+}
+
+// lintRepo resolves the chart of the repository and runs the Helm chart
+// linter on it with the release values.
+func (app *App) lintRepo(file string, repo config.RepositorySpec, pos config.Position) []lintProblem {
+	problem := func(err error) []lintProblem {
+		return []lintProblem{{File: file, Position: pos, Release: repo.Name, Severity: lintError, Message: err.Error()}}
+	}
+	source, err := app.chartSourceFromRepo(file, repo)
+	if err != nil {
+		return problem(err)
+	}
+	values, err := app.valuesFromRepo(file, repo, nil, nil)
+	if err != nil {
+		return problem(err)
+	}
+	opts := &helm.ReleaseOptions{
+		Name:        repo.Name,
+		Namespace:   cmp.Or(repo.Namespace, DefaultNamespace),
+		KubeVersion: repo.KubeVersion,
+	}
+	messages, err := app.render.LintChart(source, opts, values)
+	if err != nil {
+		return problem(err)
+	}
+	var problems []lintProblem
+	for _, m := range messages {
+		p := lintProblem{Release: repo.Name, Severity: lintSeverity(m.Severity), Message: m.Err.Error()}
+		if source.Kind == helm.LocalDirectorySource {
+			p.File = filepath.Join(source.Path, m.Path)
+		} else {
+			p.File = m.Path
+			p.Message = fmt.Sprintf("%s: %s", source, p.Message)
+		}
+		problems = append(problems, p)
+	}
+	return problems
+}
+
+// lintSource compiles the inline KCL source without running it. The sources
+// referencing a file, a url or an OCI artifact are fetched by KCL at run time
+// and are not compiled.
+func lintSource(file, source string, positions *config.KCLRunPositions) []lintProblem {
+	if source == "" || isSourceReference(source) {
+		return nil
+	}
+	result, err := kcl.LoadPackage(&kcl.LoadPackageArgs{
+		ParseArgs: &kcl.ParseProgramArgs{
+			Paths:   []string{"main.k"},
+			Sources: []string{source},
+		},
+		ResolveAst:  true,
+		LoadBuiltin: true,
+	})
+	if err != nil {
+		return []lintProblem{{File: file, Position: positions.Source, Severity: lintError, Message: err.Error()}}
+	}
+	var problems []lintProblem
+	for _, e := range append(result.ParseErrors, result.TypeErrors...) {
+		for _, m := range e.Messages {
+			var line, column int
+			if m.Pos != nil {
+				line, column = int(m.Pos.Line), int(m.Pos.Column)
+			}
+			problems = append(problems, sourceProblem(file, positions, e.Level, m.Msg, line, column))
+		}
+	}
+	return problems
+}
+
+// sourceProblem returns the problem of a message of the KCL compiler at the
+// line and column of the KCL source, 0 when unknown.
+func sourceProblem(file string, positions *config.KCLRunPositions, level, message string, line, column int) lintProblem {
+	return lintProblem{
+		File:     file,
+		Position: positions.SourcePosition(line, column),
+		Severity: kclSeverity(level),
+		Message:  message,
+	}
+}
+
+// isSourceReference reports whether the KCL source is a reference to the code
+// rather than the code itself.
+func isSourceReference(source string) bool {
+	source = strings.TrimSpace(source)
+	return !strings.Contains(source, "\n") && (strings.Contains(source, "://") || strings.HasSuffix(source, ".k"))
+}
+
+func lintSeverity(severity int) string {
+	switch severity {
+	case support.ErrorSev:
+		return lintError
+	case support.WarningSev:
+		return lintWarning
+	default:
+		return lintInfo
+	}
+}
+
+// kclSeverity returns the severity of a KCL compiler message level, an error
+// for the levels it does not know.
+func kclSeverity(level string) string {
+	switch strings.ToLower(level) {
+	case "warning":
+		return lintWarning
+	case "note", "suggestions":
+		return lintInfo
+	default:
+		return lintError
+	}
+}
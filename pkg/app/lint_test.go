@@ -0,0 +1,142 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"kcl-lang.io/helm-kcl/pkg/config"
+)
+
+func TestProblemsFromError(t *testing.T) {
+	first := &config.FieldError{File: "kcl-run.yaml", Position: config.Position{Line: 3, Column: 3}, Message: "field sorce not found"}
+	second := &config.FieldError{File: "kcl-run.yaml", Position: config.Position{Line: 9, Column: 5}, Message: "repository requires a path or a url"}
+	tests := []struct {
+		name string
+		err  error
+		want []lintProblem
+	}{
+		{
+			name: "field error",
+			err:  first,
+			want: []lintProblem{{File: "kcl-run.yaml", Position: first.Position, Severity: lintError, Message: first.Message}},
+		},
+		{
+			name: "joined field errors",
+			err:  errors.Join(first, second),
+			want: []lintProblem{
+				{File: "kcl-run.yaml", Position: first.Position, Severity: lintError, Message: first.Message},
+				{File: "kcl-run.yaml", Position: second.Position, Severity: lintError, Message: second.Message},
+			},
+		},
+		{
+			name: "nested joined errors",
+			err:  errors.Join(errors.Join(first), fmt.Errorf("wrapped: %w", second), errors.New("not a field error")),
+			want: []lintProblem{
+				{File: "kcl-run.yaml", Position: first.Position, Severity: lintError, Message: first.Message},
+				{File: "kcl-run.yaml", Position: second.Position, Severity: lintError, Message: second.Message},
+				{File: "main.yaml", Severity: lintError, Message: "not a field error"},
+			},
+		},
+		{
+			name: "other error",
+			err:  errors.New("open main.yaml: no such file or directory"),
+			want: []lintProblem{{File: "main.yaml", Severity: lintError, Message: "open main.yaml: no such file or directory"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := problemsFromError("main.yaml", tt.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("problemsFromError() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProblemsFromKCLRunErrors(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "kcl-run.yaml")
+	data := `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+spec:
+  sorce: a = 1
+repositories:
+- name: app
+  path: ./app
+  vrsion: 1.0.0
+`
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := config.FromFile(file)
+	if err == nil {
+		t.Fatal("expected the unknown fields to be reported")
+	}
+	want := []lintProblem{
+		{File: file, Position: config.Position{Line: 4, Column: 3}, Severity: lintError, Message: `unknown field "sorce" in spec`},
+		{File: file, Position: config.Position{Line: 4, Column: 3}, Severity: lintError, Message: "spec.source is required"},
+		{File: file, Position: config.Position{Line: 8, Column: 3}, Severity: lintError, Message: `unknown field "vrsion" in repositories[0]`},
+	}
+	if got := problemsFromError(file, err); !reflect.DeepEqual(got, want) {
+		t.Errorf("problemsFromError() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSourceProblem(t *testing.T) {
+	positions := &config.KCLRunPositions{Source: config.Position{Line: 4, Column: 11}, SourceBlock: true, SourceIndent: 4}
+	tests := []struct {
+		level        string
+		line, column int
+		want         lintProblem
+	}{
+		{
+			level: "Error", line: 2, column: 5,
+			want: lintProblem{File: "kcl-run.yaml", Position: config.Position{Line: 6, Column: 9}, Severity: lintError, Message: "message"},
+		},
+		{
+			level: "Warning", line: 1, column: 1,
+			want: lintProblem{File: "kcl-run.yaml", Position: config.Position{Line: 5, Column: 5}, Severity: lintWarning, Message: "message"},
+		},
+		{
+			level: "Suggestions",
+			want:  lintProblem{File: "kcl-run.yaml", Position: positions.Source, Severity: lintInfo, Message: "message"},
+		},
+		{
+			level: "Note",
+			want:  lintProblem{File: "kcl-run.yaml", Position: positions.Source, Severity: lintInfo, Message: "message"},
+		},
+		{
+			level: "Fatal",
+			want:  lintProblem{File: "kcl-run.yaml", Position: positions.Source, Severity: lintError, Message: "message"},
+		},
+		{
+			level: "",
+			want:  lintProblem{File: "kcl-run.yaml", Position: positions.Source, Severity: lintError, Message: "message"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			if got := sourceProblem("kcl-run.yaml", positions, tt.level, "message", tt.line, tt.column); got != tt.want {
+				t.Errorf("sourceProblem() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLintSourceReferences(t *testing.T) {
+	// The sources fetched by KCL at run time are not compiled.
+	sources := []string{
+		"",
+		"main.k",
+		"./policies/main.k\n",
+		"oci://ghcr.io/kcl-lang/set-annotation",
+		"https://github.com/kcl-lang/krm-kcl/blob/main/examples/set-annotation/main.k",
+	}
+	for _, source := range sources {
+		if problems := lintSource("kcl-run.yaml", source, &config.KCLRunPositions{}); problems != nil {
+			t.Errorf("lintSource(%q) = %+v, want nothing", source, problems)
+		}
+	}
+}
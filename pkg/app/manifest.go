@@ -0,0 +1,109 @@
+package app
+
+import (
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+)
+
+const (
+	// annotationPrefix is the prefix of the annotations recorded by helm-kcl.
+	annotationPrefix = "helm-kcl.dev/"
+	// SourceAnnotation records the chart template an item was rendered from.
+	SourceAnnotation = annotationPrefix + "source"
+	// ReleaseAnnotation records the release an item was rendered from.
+	ReleaseAnnotation = annotationPrefix + "release"
+	// ChartAnnotation records the chart name and version an item was rendered from.
+	ChartAnnotation = annotationPrefix + "chart"
+
+	sourceCommentPrefix = "# Source: "
+)
+
+// parseManifests parses the manifests rendered by Helm into kube objects. When
+// annotate is true, every object records the template it was rendered from,
+// taken from the "# Source:" comment Helm emits, in the SourceAnnotation.
+func parseManifests(manifests []byte, annotate bool) (kube.KubeObjects, error) {
+	if !annotate {
+		return kube.ParseKubeObjects(manifests)
+	}
+	docs := releaseutil.SplitManifests(string(manifests))
+	keys := make([]string, 0, len(docs))
+	for key := range docs {
+		keys = append(keys, key)
+	}
+	sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+
+	var items kube.KubeObjects
+	for _, key := range keys {
+		objects, err := kube.ParseKubeObjects([]byte(docs[key]))
+		if err != nil {
+			return nil, err
+		}
+		if source := sourceFromManifest(docs[key]); source != "" {
+			for _, o := range objects {
+				if err := o.SetAnnotation(SourceAnnotation, source); err != nil {
+					return nil, err
+				}
+			}
+		}
+		items = append(items, objects...)
+	}
+	return items, nil
+}
+
+// sourceFromManifest returns the template path of the "# Source:" comment of
+// a single manifest document.
+func sourceFromManifest(doc string) string {
+	for _, line := range strings.Split(doc, "\n") {
+		if strings.HasPrefix(line, sourceCommentPrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, sourceCommentPrefix))
+		}
+	}
+	return ""
+}
+
+// annotateRelease records the release and the chart of the items in the
+// ReleaseAnnotation and the ChartAnnotation.
+func annotateRelease(items kube.KubeObjects, r *release) error {
+	chart := r.chart.Metadata.Name + "-" + r.chart.Metadata.Version
+	for _, o := range items {
+		if err := o.SetAnnotation(ReleaseAnnotation, r.opts.Name); err != nil {
+			return err
+		}
+		if err := o.SetAnnotation(ChartAnnotation, chart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripAnnotations removes the annotation keys from the items that have them.
+func stripAnnotations(items kube.KubeObjects, keys ...string) error {
+	for _, o := range items {
+		for _, key := range keys {
+			if _, ok := o.GetAnnotations()[key]; !ok {
+				continue
+			}
+			if err := removeAnnotation(o, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// removeAnnotation removes the annotation key from o, dropping the annotations
+// field altogether when it becomes empty.
+func removeAnnotation(o *kube.KubeObject, key string) error {
+	if _, err := o.RemoveNestedField("metadata", "annotations", key); err != nil {
+		return err
+	}
+	if len(o.GetAnnotations()) == 0 {
+		if _, err := o.RemoveNestedField("metadata", "annotations"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
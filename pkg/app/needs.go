@@ -0,0 +1,133 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"kcl-lang.io/helm-kcl/pkg/config"
+)
+
+// checkNeeds fails when a repository needs a release that is not defined or
+// when the needs of the repositories form a cycle.
+func checkNeeds(repos []config.RepositorySpec) error {
+	byName := make(map[string]config.RepositorySpec, len(repos))
+	for _, repo := range repos {
+		byName[repo.Name] = repo
+	}
+	var errs []error
+	for _, repo := range repos {
+		for _, need := range repo.Needs {
+			if _, ok := byName[need]; !ok {
+				errs = append(errs, fmt.Errorf("release %q needs %q which is not defined", repo.Name, need))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	const (
+		visiting = iota + 1
+		visited
+	)
+	state := make(map[string]int, len(repos))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			for i, n := range path {
+				if n == name {
+					return fmt.Errorf("dependency cycle detected: %s", strings.Join(append(path[i:], name), " -> "))
+				}
+			}
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, need := range byName[name].Needs {
+			if err := visit(need); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, repo := range repos {
+		if err := visit(repo.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// includeNeeds returns the selected repositories along with the repositories
+// they need, transitively or not, in the order of all.
+func includeNeeds(all, selected []config.RepositorySpec, transitive bool) []config.RepositorySpec {
+	byName := make(map[string]config.RepositorySpec, len(all))
+	for _, repo := range all {
+		byName[repo.Name] = repo
+	}
+	included := make(map[string]bool, len(all))
+	var include func(repo config.RepositorySpec, needed bool)
+	include = func(repo config.RepositorySpec, needed bool) {
+		if included[repo.Name] && needed {
+			return
+		}
+		included[repo.Name] = true
+		if needed && !transitive {
+			return
+		}
+		for _, need := range repo.Needs {
+			include(byName[need], true)
+		}
+	}
+	for _, repo := range selected {
+		include(repo, false)
+	}
+	var repos []config.RepositorySpec
+	for _, repo := range all {
+		if included[repo.Name] {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+// levelsByNeeds sorts the repositories topologically by their needs. Every
+// level holds, in declaration order, the repositories whose needs are all in
+// the previous levels. Needs that are not among the repositories are ignored.
+// The needs must have been checked with checkNeeds.
+func levelsByNeeds(repos []config.RepositorySpec) [][]config.RepositorySpec {
+	byName := make(map[string]config.RepositorySpec, len(repos))
+	for _, repo := range repos {
+		byName[repo.Name] = repo
+	}
+	levelOf := make(map[string]int, len(repos))
+	var level func(repo config.RepositorySpec) int
+	level = func(repo config.RepositorySpec) int {
+		if l, ok := levelOf[repo.Name]; ok {
+			return l
+		}
+		l := 0
+		for _, need := range repo.Needs {
+			if needed, ok := byName[need]; ok {
+				l = max(l, level(needed)+1)
+			}
+		}
+		levelOf[repo.Name] = l
+		return l
+	}
+	var levels [][]config.RepositorySpec
+	for _, repo := range repos {
+		l := level(repo)
+		for len(levels) <= l {
+			levels = append(levels, nil)
+		}
+		levels[l] = append(levels[l], repo)
+	}
+	return levels
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"kcl-lang.io/helm-kcl/pkg/config"
+)
+
+// testRepos returns the repositories named like "web:api,db", i.e. a name and
+// the comma separated releases it needs.
+func testRepos(specs ...string) []config.RepositorySpec {
+	repos := make([]config.RepositorySpec, len(specs))
+	for i, spec := range specs {
+		name, needs, _ := strings.Cut(spec, ":")
+		repos[i] = config.RepositorySpec{Name: name, Path: "./" + name}
+		if needs != "" {
+			repos[i].Needs = strings.Split(needs, ",")
+		}
+	}
+	return repos
+}
+
+func repoNames(repos []config.RepositorySpec) []string {
+	names := make([]string, len(repos))
+	for i, repo := range repos {
+		names[i] = repo.Name
+	}
+	return names
+}
+
+func TestCheckNeeds(t *testing.T) {
+	tests := []struct {
+		name    string
+		repos   []config.RepositorySpec
+		wantErr string
+	}{
+		{name: "no needs", repos: testRepos("db", "web")},
+		{name: "needs", repos: testRepos("web:api", "api:db", "db")},
+		{name: "undefined", repos: testRepos("web:api"), wantErr: `release "web" needs "api" which is not defined`},
+		{name: "self cycle", repos: testRepos("db:db"), wantErr: "dependency cycle detected: db -> db"},
+		{name: "cycle", repos: testRepos("web:api", "api:db", "db:web"), wantErr: "dependency cycle detected: web -> api -> db -> web"},
+		{name: "cycle after a dag", repos: testRepos("x", "db", "api:db,cache", "cache:api"), wantErr: "dependency cycle detected: api -> cache -> api"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkNeeds(tt.repos)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIncludeNeeds(t *testing.T) {
+	all := testRepos("db", "cache", "api:db,cache", "web:api", "docs")
+	tests := []struct {
+		name       string
+		selected   []string
+		transitive bool
+		want       []string
+	}{
+		{name: "no needs", selected: []string{"docs"}, want: []string{"docs"}},
+		{name: "direct", selected: []string{"web"}, want: []string{"api", "web"}},
+		{name: "transitive", selected: []string{"web"}, transitive: true, want: []string{"db", "cache", "api", "web"}},
+		{name: "selected need", selected: []string{"api", "web"}, want: []string{"db", "cache", "api", "web"}},
+		{name: "declaration order", selected: []string{"docs", "api"}, want: []string{"db", "cache", "api", "docs"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var selected []config.RepositorySpec
+			for _, repo := range all {
+				for _, name := range tt.selected {
+					if repo.Name == name {
+						selected = append(selected, repo)
+					}
+				}
+			}
+			got := repoNames(includeNeeds(all, selected, tt.transitive))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("includeNeeds() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectReposNeeds(t *testing.T) {
+	all := testRepos("db", "api:db", "web:api")
+	tests := []struct {
+		name   string
+		opts   config.TemplateOptions
+		want   []string
+		levels string
+	}{
+		{name: "skip needs", opts: config.TemplateOptions{SkipNeeds: true}, want: []string{"web"}, levels: "[[web]]"},
+		{name: "include needs", opts: config.TemplateOptions{SkipNeeds: true, IncludeNeeds: true}, want: []string{"api", "web"}, levels: "[[api] [web]]"},
+		{name: "include transitive needs", opts: config.TemplateOptions{SkipNeeds: true, IncludeTransitiveNeeds: true}, want: []string{"db", "api", "web"}, levels: "[[db] [api] [web]]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Selectors = []string{"name=web"}
+			selected, err := (&App{}).selectRepos(config.NewTemplateImpl(&tt.opts), all)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := repoNames(selected); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectRepos() = %v, want %v", got, tt.want)
+			}
+			// The needs left out are ignored when ordering the selected releases.
+			if got := fmt.Sprint(levelNames(levelsByNeeds(selected))); got != tt.levels {
+				t.Errorf("levelsByNeeds() = %s, want %s", got, tt.levels)
+			}
+		})
+	}
+}
+
+func levelNames(levels [][]config.RepositorySpec) [][]string {
+	names := make([][]string, len(levels))
+	for i, level := range levels {
+		names[i] = repoNames(level)
+	}
+	return names
+}
+
+func TestLevelsByNeeds(t *testing.T) {
+	tests := []struct {
+		name  string
+		repos []config.RepositorySpec
+		want  string
+	}{
+		{name: "no needs", repos: testRepos("db", "web"), want: "[[db web]]"},
+		{name: "chain", repos: testRepos("db", "api:db", "web:api"), want: "[[db] [api] [web]]"},
+		{name: "declared before their needs", repos: testRepos("web:api", "api:db", "db", "x"), want: "[[db x] [api] [web]]"},
+		{name: "diamond", repos: testRepos("web:api,cache", "api:db", "cache:db", "db"), want: "[[db] [api cache] [web]]"},
+		{name: "missing needs ignored", repos: testRepos("web:api"), want: "[[web]]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fmt.Sprint(levelNames(levelsByNeeds(tt.repos))); got != tt.want {
+				t.Errorf("levelsByNeeds() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"kcl-lang.io/helm-kcl/pkg/config"
+	"kcl-lang.io/helm-kcl/pkg/helm"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+)
+
+// generatedSource is the file of the items which have no source template,
+// e.g. the ones added by the KCL code.
+const generatedSource = "generated.yaml"
+
+// outputDirTemplateData is the data of the --output-dir-template go template.
+type outputDirTemplateData struct {
+	OutputDir string
+	State     outputDirState
+	Release   *helm.ReleaseOptions
+}
+
+// outputDirState describes the KCL state file of the releases.
+type outputDirState struct {
+	// BaseName is the file name of the KCL state file without the extension.
+	BaseName string
+	// AbsPath is the absolute path of the directory of the KCL state file.
+	AbsPath string
+	// AbsPathSHA1 is the first 8 characters of the SHA1 of the absolute path of the KCL state file.
+	AbsPathSHA1 string
+}
+
+// writeToDir reports whether the manifests are written to output dirs instead of stdout.
+func writeToDir(templateImpl *config.TemplateImpl) bool {
+	return templateImpl.OutputDir() != "" || templateImpl.OutputDirTemplate() != ""
+}
+
+// keepAnnotations reports whether the annotations added by --annotate are
+// kept in the output.
+func keepAnnotations(templateImpl *config.TemplateImpl) bool {
+	return templateImpl.Annotate() && !templateImpl.StripAnnotations()
+}
+
+// outputDirFromTemplate returns the output directory of the release computed
+// from the output dir template.
+func outputDirFromTemplate(templateImpl *config.TemplateImpl, opts *helm.ReleaseOptions) (string, error) {
+	outputDirTemplate := templateImpl.OutputDirTemplate()
+	if outputDirTemplate == "" {
+		outputDirTemplate = DefaultOutputDirTemplate
+	}
+	tmpl, err := template.New("output-dir").Parse(outputDirTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid output dir template %q: %w", outputDirTemplate, err)
+	}
+	absPath, err := filepath.Abs(templateImpl.File)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(absPath))
+	data := outputDirTemplateData{
+		OutputDir: templateImpl.OutputDir(),
+		State: outputDirState{
+			BaseName:    strings.TrimSuffix(filepath.Base(absPath), filepath.Ext(absPath)),
+			AbsPath:     filepath.Dir(absPath),
+			AbsPathSHA1: hex.EncodeToString(sum[:])[:8],
+		},
+		Release: opts,
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute output dir template %q: %w", outputDirTemplate, err)
+	}
+	return filepath.Clean(buf.String()), nil
+}
+
+// writeManifests writes the items to outputDir with one file per source
+// template, as "helm template --output-dir" does. The SourceAnnotation is
+// removed from the items unless keepSource is set.
+func writeManifests(outputDir string, items kube.KubeObjects, keepSource bool) error {
+	var sources []string
+	files := map[string]kube.KubeObjects{}
+	for _, o := range items {
+		source := o.GetAnnotation(SourceAnnotation)
+		if source == "" {
+			source = generatedSource
+		} else if !keepSource {
+			if err := removeAnnotation(o, SourceAnnotation); err != nil {
+				return err
+			}
+		}
+		if _, ok := files[source]; !ok {
+			sources = append(sources, source)
+		}
+		files[source] = append(files[source], o)
+	}
+	for _, source := range sources {
+		var buf bytes.Buffer
+		for _, o := range files[source] {
+			fmt.Fprintf(&buf, "---\n# Source: %s\n%s\n", source, strings.TrimSpace(kube.KubeObjects{o}.MustString()))
+		}
+		if !filepath.IsLocal(filepath.FromSlash(source)) {
+			return fmt.Errorf("source %q of the output manifests is not a relative path inside the output dir", source)
+		}
+		file := filepath.Join(outputDir, filepath.FromSlash(source))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("wrote %s\n", file)
+	}
+	return nil
+}
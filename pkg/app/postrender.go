@@ -0,0 +1,120 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/postrender"
+	"kcl-lang.io/helm-kcl/pkg/config"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+)
+
+// newPostRenderer returns the post renderer set on the command line, or nil
+// when there is none.
+func newPostRenderer(templateImpl *config.TemplateImpl) (postrender.PostRenderer, error) {
+	if templateImpl.PostRenderer() == "" {
+		return nil, nil
+	}
+	switch templateImpl.PostRendererStage() {
+	case config.PostRendererBeforeKCL, config.PostRendererAfterKCL:
+	default:
+		return nil, fmt.Errorf("invalid post renderer stage %q, it should be %q or %q",
+			templateImpl.PostRendererStage(), config.PostRendererBeforeKCL, config.PostRendererAfterKCL)
+	}
+	return postrender.NewExec(templateImpl.PostRenderer(), templateImpl.PostRendererArgs()...)
+}
+
+// postRender pipes the items through the post renderer when it runs at stage.
+// Unless they are asked for with --annotate, the annotations helm-kcl records
+// for its own use are hidden from the post renderer, and restored on the items
+// it returns by their position, or by their API version, kind, namespace and
+// name when it adds or removes items.
+func (app *App) postRender(templateImpl *config.TemplateImpl, stage string, items kube.KubeObjects) (kube.KubeObjects, error) {
+	if app.postRenderer == nil || templateImpl.PostRendererStage() != stage || len(items) == 0 {
+		return items, nil
+	}
+	var hidden []map[string]string
+	keys := make([]string, len(items))
+	if !templateImpl.Annotate() {
+		for i, o := range items {
+			keys[i] = objectKey(o)
+		}
+		var err error
+		hidden, err = hideAnnotations(items, SourceAnnotation, ReleaseAnnotation)
+		if err != nil {
+			return nil, err
+		}
+	}
+	out, err := app.postRenderer.Run(bytes.NewBufferString(items.MustString()))
+	if err != nil {
+		return nil, fmt.Errorf("error while running the post renderer: %w", err)
+	}
+	items, err = kube.ParseKubeObjects(out.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if err := restoreAnnotations(items, hidden, keys); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// hideAnnotations removes the annotation keys from the items, returning their
+// values by item index, or nil when none of the items has them.
+func hideAnnotations(items kube.KubeObjects, keys ...string) ([]map[string]string, error) {
+	var hidden []map[string]string
+	for i, o := range items {
+		annotations := o.GetAnnotations()
+		for _, key := range keys {
+			if value, ok := annotations[key]; ok {
+				if hidden == nil {
+					hidden = make([]map[string]string, len(items))
+				}
+				if hidden[i] == nil {
+					hidden[i] = map[string]string{}
+				}
+				hidden[i][key] = value
+			}
+		}
+	}
+	return hidden, stripAnnotations(items, keys...)
+}
+
+// restoreAnnotations sets the hidden annotations back on the post rendered
+// items. When the post renderer kept the number of items, they are restored by
+// index, so that renamed items keep them. Otherwise every item has to match a
+// single one of the items with the objectKeys given to the post renderer.
+func restoreAnnotations(items kube.KubeObjects, hidden []map[string]string, keys []string) error {
+	if hidden == nil {
+		return nil
+	}
+	if len(items) != len(hidden) {
+		byKey := map[string][]map[string]string{}
+		for i, key := range keys {
+			byKey[key] = append(byKey[key], hidden[i])
+		}
+		hidden = make([]map[string]string, len(items))
+		for i, o := range items {
+			matches := byKey[objectKey(o)]
+			if len(matches) != 1 {
+				return fmt.Errorf("cannot restore the helm-kcl annotations of %s after the post renderer changed the number of items from %d to %d, run with --annotate to pass them to it",
+					describeObject(o), len(keys), len(items))
+			}
+			hidden[i] = matches[0]
+		}
+	}
+	for i, o := range items {
+		for key, value := range hidden[i] {
+			if err := o.SetAnnotation(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// objectKey identifies o by its API version, kind, namespace and name.
+func objectKey(o *kube.KubeObject) string {
+	return strings.Join([]string{o.GetAPIVersion(), o.GetKind(), o.GetNamespace(), o.GetName()}, "/")
+}
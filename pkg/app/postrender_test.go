@@ -0,0 +1,157 @@
+package app
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"kcl-lang.io/helm-kcl/pkg/config"
+)
+
+// testPostRenderer records its input and outputs it through transform, or
+// hands the items to another team when it is nil.
+type testPostRenderer struct {
+	input     string
+	transform func(string) string
+}
+
+func (p *testPostRenderer) Run(in *bytes.Buffer) (*bytes.Buffer, error) {
+	p.input = in.String()
+	if p.transform != nil {
+		return bytes.NewBufferString(p.transform(p.input)), nil
+	}
+	return bytes.NewBufferString(strings.ReplaceAll(p.input, "team: payments", "team: platform")), nil
+}
+
+func TestPostRenderAnnotations(t *testing.T) {
+	const manifests = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+  annotations:
+    helm-kcl.dev/source: app/templates/configmap.yaml
+    team: payments
+`
+	tests := []struct {
+		name     string
+		annotate bool
+		// seen reports whether the post renderer sees the source annotation.
+		seen bool
+	}{
+		{name: "hidden", annotate: false, seen: false},
+		{name: "annotate", annotate: true, seen: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			postRenderer := &testPostRenderer{}
+			app := &App{postRenderer: postRenderer}
+			templateImpl := config.NewTemplateImpl(&config.TemplateOptions{
+				PostRendererStage: config.PostRendererBeforeKCL,
+				Annotate:          tt.annotate,
+			})
+			items, err := app.postRender(templateImpl, config.PostRendererBeforeKCL, mustParseKubeObjects(t, manifests))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Contains(postRenderer.input, SourceAnnotation); got != tt.seen {
+				t.Errorf("post renderer saw the source annotation: %v, want %v:\n%s", got, tt.seen, postRenderer.input)
+			}
+			if !strings.Contains(postRenderer.input, "team: payments") {
+				t.Errorf("post renderer did not see the other annotations:\n%s", postRenderer.input)
+			}
+			if len(items) != 1 {
+				t.Fatalf("got %d items, want 1", len(items))
+			}
+			if got := items[0].GetAnnotation(SourceAnnotation); got != "app/templates/configmap.yaml" {
+				t.Errorf("source annotation = %q after post rendering", got)
+			}
+			if items[0].GetAnnotation("team") != "platform" {
+				t.Errorf("the post renderer output was not used:\n%s", items[0].MustString())
+			}
+		})
+	}
+}
+
+func TestPostRenderRestoreAnnotations(t *testing.T) {
+	// The same ConfigMap rendered by two releases with --combined.
+	const manifests = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+  annotations:
+    helm-kcl.dev/release: blue
+    helm-kcl.dev/source: app/templates/configmap.yaml
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+  annotations:
+    helm-kcl.dev/release: green
+    helm-kcl.dev/source: app/templates/configmap.yaml
+---
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+  annotations:
+    helm-kcl.dev/release: green
+    helm-kcl.dev/source: app/templates/secret.yaml
+`
+	const added = `---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: apps
+`
+	tests := []struct {
+		name      string
+		transform func(string) string
+		// releases are the release annotations of the output items.
+		releases []string
+		wantErr  string
+	}{
+		{
+			name:      "renamed",
+			transform: func(s string) string { return strings.ReplaceAll(s, "name: app", "name: prod-app") },
+			releases:  []string{"blue", "green", "green"},
+		},
+		{
+			name: "removed",
+			transform: func(s string) string {
+				docs := strings.Split(s, "---\n")
+				return docs[2]
+			},
+			releases: []string{"green"},
+		},
+		{
+			name:      "added",
+			transform: func(s string) string { return s + added },
+			wantErr:   "cannot restore the helm-kcl annotations of ConfigMap app",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := &App{postRenderer: &testPostRenderer{transform: tt.transform}}
+			templateImpl := config.NewTemplateImpl(&config.TemplateOptions{PostRendererStage: config.PostRendererAfterKCL})
+			items, err := app.postRender(templateImpl, config.PostRendererAfterKCL, mustParseKubeObjects(t, manifests))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var releases []string
+			for _, o := range items {
+				releases = append(releases, o.GetAnnotation(ReleaseAnnotation))
+			}
+			if !slices.Equal(releases, tt.releases) {
+				t.Errorf("release annotations = %v, want %v", releases, tt.releases)
+			}
+		})
+	}
+}
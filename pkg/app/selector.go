@@ -0,0 +1,106 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"kcl-lang.io/helm-kcl/pkg/config"
+)
+
+// labelSelector matches the labels of a release against the comma separated
+// key=value and key!=value terms of a --selector flag, all of which must hold.
+type labelSelector struct {
+	equal    [][2]string
+	notEqual [][2]string
+}
+
+// parseLabelSelector parses a selector such as "tier=backend,name!=db". Keys
+// and values must not be empty, and "==" is not an operator.
+func parseLabelSelector(selector string) (*labelSelector, error) {
+	s := &labelSelector{}
+	for _, term := range strings.Split(selector, ",") {
+		term = strings.TrimSpace(term)
+		key, value, notEqual := strings.Cut(term, "!=")
+		ok := notEqual
+		if !notEqual {
+			key, value, ok = strings.Cut(term, "=")
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" || strings.Contains(key, "=") || strings.HasPrefix(value, "=") {
+			return nil, fmt.Errorf("malformed selector term %q in %q, it should be key=value or key!=value", term, selector)
+		}
+		if notEqual {
+			s.notEqual = append(s.notEqual, [2]string{key, value})
+		} else {
+			s.equal = append(s.equal, [2]string{key, value})
+		}
+	}
+	return s, nil
+}
+
+// matches reports whether the labels satisfy all the terms of the selector.
+func (s *labelSelector) matches(labels map[string]string) bool {
+	for _, kv := range s.equal {
+		if labels[kv[0]] != kv[1] {
+			return false
+		}
+	}
+	for _, kv := range s.notEqual {
+		if labels[kv[0]] == kv[1] {
+			return false
+		}
+	}
+	return true
+}
+
+// selectRepos returns the repositories matching any of the --selector flags,
+// all of them when no selector is set, along with the repositories they need
+// unless needs are skipped.
+func (app *App) selectRepos(templateImpl *config.TemplateImpl, repos []config.RepositorySpec) ([]config.RepositorySpec, error) {
+	if len(templateImpl.Selectors()) == 0 {
+		return repos, nil
+	}
+	selectors := make([]*labelSelector, len(templateImpl.Selectors()))
+	for i, selector := range templateImpl.Selectors() {
+		s, err := parseLabelSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+		selectors[i] = s
+	}
+	var selected []config.RepositorySpec
+	for _, repo := range repos {
+		labels := app.labelsFromRepo(templateImpl, repo)
+		for _, s := range selectors {
+			if s.matches(labels) {
+				selected = append(selected, repo)
+				break
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no release matches the selectors %s", strings.Join(templateImpl.Selectors(), " "))
+	}
+	if !templateImpl.SkipNeeds() {
+		selected = includeNeeds(repos, selected, templateImpl.IncludeTransitiveNeeds())
+	}
+	return selected, nil
+}
+
+// labelsFromRepo returns the labels of the repository along with the implicit
+// name, namespace and chart labels of the release.
+func (app *App) labelsFromRepo(templateImpl *config.TemplateImpl, repo config.RepositorySpec) map[string]string {
+	labels := make(map[string]string, len(repo.Labels)+3)
+	for k, v := range repo.Labels {
+		labels[k] = v
+	}
+	labels["name"] = repo.Name
+	labels["namespace"] = app.releaseOptionsFromRepo(repo, templateImpl).Namespace
+	if repo.Chart != "" {
+		labels["chart"] = repo.Chart
+	} else if repo.Path != "" {
+		labels["chart"] = filepath.Base(repo.Path)
+	}
+	return labels
+}
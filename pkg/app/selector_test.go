@@ -0,0 +1,81 @@
+package app
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     *labelSelector
+		wantErr  bool
+	}{
+		{
+			selector: "tier=backend",
+			want:     &labelSelector{equal: [][2]string{{"tier", "backend"}}},
+		},
+		{
+			selector: " tier = backend , name!=db ",
+			want: &labelSelector{
+				equal:    [][2]string{{"tier", "backend"}},
+				notEqual: [][2]string{{"name", "db"}},
+			},
+		},
+		{selector: "", wantErr: true},
+		{selector: "tier", wantErr: true},
+		{selector: "tier=backend,", wantErr: true},
+		{selector: "=backend", wantErr: true},
+		{selector: "!=backend", wantErr: true},
+		{selector: "tier=", wantErr: true},
+		{selector: "tier!=", wantErr: true},
+		{selector: "tier==backend", wantErr: true},
+		{selector: "tier!==backend", wantErr: true},
+		{selector: "tier=!=backend", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			got, err := parseLabelSelector(tt.selector)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseLabelSelector(%q) = %+v, want an error", tt.selector, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLabelSelector(%q): %v", tt.selector, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLabelSelector(%q) = %+v, want %+v", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLabelSelectorMatches(t *testing.T) {
+	labels := map[string]string{"name": "api", "tier": "backend"}
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{selector: "tier=backend", want: true},
+		{selector: "tier=frontend", want: false},
+		{selector: "tier!=frontend", want: true},
+		{selector: "tier!=backend", want: false},
+		{selector: "tier=backend,name=api", want: true},
+		{selector: "tier=backend,name!=api", want: false},
+		{selector: "team=payments", want: false},
+		{selector: "team!=payments", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			s, err := parseLabelSelector(tt.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.matches(labels); got != tt.want {
+				t.Errorf("matches(%v) = %v, want %v", labels, got, tt.want)
+			}
+		})
+	}
+}
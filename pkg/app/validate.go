@@ -0,0 +1,274 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"kcl-lang.io/helm-kcl/pkg/config"
+	"kcl-lang.io/krm-kcl/pkg/kube"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// defaultSchemaLocationTemplate is the layout of the schema locations
+	// which are not go templates, as in github.com/yannh/kubernetes-json-schema.
+	defaultSchemaLocationTemplate = "{{ .NormalizedKubernetesVersion }}-standalone-strict/{{ .ResourceKind }}{{ .KindSuffix }}.json"
+	// defaultSchemaKubeVersion is the kube version of the schemas when none is set.
+	defaultSchemaKubeVersion = "master"
+)
+
+// schemaLocationData is the data of the --schema-location go templates.
+type schemaLocationData struct {
+	// NormalizedKubernetesVersion is the kube version such as v1.30.0 or master.
+	NormalizedKubernetesVersion string
+	// ResourceKind is the lower case kind of the resource.
+	ResourceKind string
+	// ResourceAPIVersion is the version of the API version of the resource.
+	ResourceAPIVersion string
+	// Group is the API group of the resource.
+	Group string
+	// KindSuffix is -<first group element>-<version>, e.g. -apps-v1, or -<version> for the core group.
+	KindSuffix string
+}
+
+// schemaValidator validates items offline against the JSON schemas of the
+// schema locations and the openAPIV3Schema of the rendered CRDs.
+type schemaValidator struct {
+	locations     []string
+	ignoreMissing bool
+	compiler      *jsonschema.Compiler
+	// schemas are the compiled schemas keyed by file or CRD URL, nil when missing.
+	schemas map[string]*jsonschema.Schema
+	// crds are the URLs of the CRD schemas keyed by API version and kind.
+	crds map[string]string
+}
+
+func newSchemaValidator(locations []string, ignoreMissing bool) *schemaValidator {
+	compiler := jsonschema.NewCompiler()
+	// Kubernetes schemas without $schema are OpenAPI schemas, which are close to draft 4.
+	compiler.DefaultDraft(jsonschema.Draft4)
+	return &schemaValidator{
+		locations:     locations,
+		ignoreMissing: ignoreMissing,
+		compiler:      compiler,
+		schemas:       map[string]*jsonschema.Schema{},
+		crds:          map[string]string{},
+	}
+}
+
+// validate validates the items of every release, reporting all the invalid
+// items along with their release and source template.
+func (app *App) validate(templateImpl *config.TemplateImpl, releases []*release, results []kube.KubeObjects) error {
+	v := newSchemaValidator(templateImpl.SchemaLocations(), templateImpl.IgnoreMissingSchemas())
+	for _, items := range results {
+		if err := v.addCRDs(items); err != nil {
+			return err
+		}
+	}
+	var errs []error
+	for i, r := range releases {
+		for _, o := range results[i] {
+			if err := v.validate(o, r.opts.KubeVersion); err != nil {
+				errs = append(errs, fmt.Errorf("release %q: %s: %w", r.opts.Name, describeObject(o), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// describeObject returns the kind, namespace, name and source template of o.
+func describeObject(o *kube.KubeObject) string {
+	name := o.GetName()
+	if o.GetNamespace() != "" {
+		name = o.GetNamespace() + "/" + name
+	}
+	desc := fmt.Sprintf("%s %s", o.GetKind(), name)
+	if source := o.GetAnnotation(SourceAnnotation); source != "" {
+		desc += " in " + source
+	}
+	return desc
+}
+
+// addCRDs registers the openAPIV3Schema of every served version of the CRDs
+// among the items.
+func (v *schemaValidator) addCRDs(items kube.KubeObjects) error {
+	for _, o := range items {
+		if o.GetKind() != "CustomResourceDefinition" || o.GetAPIVersion() != "apiextensions.k8s.io/v1" {
+			continue
+		}
+		var crd struct {
+			Spec struct {
+				Group string `json:"group"`
+				Names struct {
+					Kind string `json:"kind"`
+				} `json:"names"`
+				Versions []struct {
+					Name   string `json:"name"`
+					Schema struct {
+						OpenAPIV3Schema map[string]interface{} `json:"openAPIV3Schema"`
+					} `json:"schema"`
+				} `json:"versions"`
+			} `json:"spec"`
+		}
+		if err := yaml.Unmarshal([]byte(o.MustString()), &crd); err != nil {
+			return fmt.Errorf("invalid CRD %s: %w", o.GetName(), err)
+		}
+		for _, version := range crd.Spec.Versions {
+			if version.Schema.OpenAPIV3Schema == nil {
+				continue
+			}
+			apiVersion := crd.Spec.Group + "/" + version.Name
+			// The same CRD may be rendered by several releases.
+			if _, ok := v.crds[apiVersion+"/"+crd.Spec.Names.Kind]; ok {
+				continue
+			}
+			url := fmt.Sprintf("crd://%s/%s/%s", crd.Spec.Group, version.Name, crd.Spec.Names.Kind)
+			doc, err := toJSONValue(openAPIToJSONSchema(version.Schema.OpenAPIV3Schema))
+			if err != nil {
+				return err
+			}
+			if err := v.compiler.AddResource(url, doc); err != nil {
+				return fmt.Errorf("invalid schema of CRD %s version %s: %w", o.GetName(), version.Name, err)
+			}
+			v.crds[apiVersion+"/"+crd.Spec.Names.Kind] = url
+		}
+	}
+	return nil
+}
+
+// validate validates o against the schema of its kind, the CRD schemas taking
+// precedence over the ones of the schema locations.
+func (v *schemaValidator) validate(o *kube.KubeObject, kubeVersion string) error {
+	schema, err := v.schemaOf(o, kubeVersion)
+	if err != nil {
+		return err
+	}
+	if schema == nil {
+		if v.ignoreMissing {
+			return nil
+		}
+		return fmt.Errorf("no schema found for %s %s", o.GetAPIVersion(), o.GetKind())
+	}
+	data, err := yaml.YAMLToJSON([]byte(o.MustString()))
+	if err != nil {
+		return err
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return schema.Validate(instance)
+}
+
+func (v *schemaValidator) schemaOf(o *kube.KubeObject, kubeVersion string) (*jsonschema.Schema, error) {
+	if url, ok := v.crds[o.GetAPIVersion()+"/"+o.GetKind()]; ok {
+		return v.compile(url)
+	}
+	data, err := newSchemaLocationData(o, kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+	for _, location := range v.locations {
+		if !strings.Contains(location, "{{") {
+			location = filepath.Join(location, defaultSchemaLocationTemplate)
+		}
+		tmpl, err := template.New("schema-location").Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schema location %q: %w", location, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to execute schema location %q: %w", location, err)
+		}
+		file, err := filepath.Abs(buf.String())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		return v.compile(file)
+	}
+	return nil, nil
+}
+
+func (v *schemaValidator) compile(url string) (*jsonschema.Schema, error) {
+	if schema, ok := v.schemas[url]; ok {
+		return schema, nil
+	}
+	schema, err := v.compiler.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", url, err)
+	}
+	v.schemas[url] = schema
+	return schema, nil
+}
+
+func newSchemaLocationData(o *kube.KubeObject, kubeVersion string) (*schemaLocationData, error) {
+	normalized := defaultSchemaKubeVersion
+	if kubeVersion != "" {
+		parsed, err := chartutil.ParseKubeVersion(kubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kube version %q: %w", kubeVersion, err)
+		}
+		normalized = parsed.Version
+	}
+	group, version, ok := strings.Cut(o.GetAPIVersion(), "/")
+	if !ok {
+		group, version = "", group
+	}
+	kindSuffix := "-" + version
+	if group != "" {
+		kindSuffix = "-" + strings.Split(group, ".")[0] + kindSuffix
+	}
+	return &schemaLocationData{
+		NormalizedKubernetesVersion: normalized,
+		ResourceKind:                strings.ToLower(o.GetKind()),
+		ResourceAPIVersion:          version,
+		Group:                       group,
+		KindSuffix:                  kindSuffix,
+	}, nil
+}
+
+// openAPIToJSONSchema rewrites the OpenAPI nullable properties of schema,
+// which JSON schemas do not have, into types allowing null.
+func openAPIToJSONSchema(schema interface{}) interface{} {
+	switch s := schema.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(s))
+		for k, v := range s {
+			out[k] = openAPIToJSONSchema(v)
+		}
+		if nullable, _ := out["nullable"].(bool); nullable {
+			if t, ok := out["type"].(string); ok {
+				out["type"] = []interface{}{t, "null"}
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(s))
+		for i, v := range s {
+			out[i] = openAPIToJSONSchema(v)
+		}
+		return out
+	default:
+		return schema
+	}
+}
+
+// toJSONValue converts v into the JSON values the schema compiler expects.
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return jsonschema.UnmarshalJSON(bytes.NewReader(data))
+}
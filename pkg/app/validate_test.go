@@ -0,0 +1,71 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+const widgetCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+  versions:
+  - name: v1
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            properties:
+              replicas:
+                type: integer
+`
+
+func TestSchemaValidatorCRDs(t *testing.T) {
+	v := newSchemaValidator(nil, false)
+	// The same CRD rendered by two releases is registered once.
+	for i := 0; i < 2; i++ {
+		if err := v.addCRDs(mustParseKubeObjects(t, widgetCRD)); err != nil {
+			t.Fatalf("addCRDs #%d: %v", i+1, err)
+		}
+	}
+	tests := []struct {
+		name    string
+		widget  string
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			widget: "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\nspec:\n  replicas: 1\n",
+		},
+		{
+			name:    "invalid",
+			widget:  "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\nspec:\n  replicas: one\n",
+			wantErr: "replicas",
+		},
+		{
+			name:    "missing schema",
+			widget:  "apiVersion: example.com/v2\nkind: Widget\nmetadata:\n  name: w\n",
+			wantErr: "no schema found for example.com/v2 Widget",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.validate(mustParseKubeObjects(t, tt.widget)[0], "")
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,9 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
 
-	"gopkg.in/yaml.v2"
 	"kcl-lang.io/krm-kcl/pkg/config"
 )
 
@@ -13,15 +13,47 @@ type KCLRun struct {
 	Repositories  []RepositorySpec `yaml:"repositories,omitempty"`
 }
 
+// FromFile reads the KCLRun file, failing on unknown fields, values of the
+// wrong type, missing required fields, invalid repositories and duplicate
+// release names.
 func FromFile(file string) (*KCLRun, error) {
 	yamlFile, err := os.ReadFile(file)
 	if err != nil {
 		return nil, err
 	}
-	var config KCLRun
-	err = yaml.Unmarshal(yamlFile, &config)
+	config, err := decodeKCLRun(file, yamlFile)
 	if err != nil {
 		return nil, err
 	}
-	return &config, nil
+	for i := range config.Repositories {
+		config.Repositories[i].Values = stringKeys(config.Repositories[i].Values).(map[string]interface{})
+	}
+	return config, nil
+}
+
+// stringKeys converts the map[interface{}]interface{} values produced by
+// yaml for mappings with non-string keys into the map[string]interface{}
+// values expected by Helm.
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[k] = stringKeys(val)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			out[fmt.Sprint(k)] = stringKeys(val)
+		}
+		return out
+	case []interface{}:
+		for i, item := range v {
+			v[i] = stringKeys(item)
+		}
+		return v
+	default:
+		return v
+	}
 }
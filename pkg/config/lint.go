@@ -0,0 +1,45 @@
+package config
+
+const (
+	// LintOutputText prints one problem per line.
+	LintOutputText = "text"
+	// LintOutputJSON prints the problems as a JSON array.
+	LintOutputJSON = "json"
+)
+
+// LintOptions is the options for the lint command
+type LintOptions struct {
+	// File is the file flag
+	File string
+	// Output is the output flag
+	Output string
+	// CacheDir is the cache dir flag
+	CacheDir string
+}
+
+// NewLintOptions creates a new LintOptions
+func NewLintOptions() *LintOptions {
+	return &LintOptions{}
+}
+
+// LintImpl is impl for LintOptions
+type LintImpl struct {
+	*LintOptions
+}
+
+// NewLintImpl creates a new LintImpl
+func NewLintImpl(l *LintOptions) *LintImpl {
+	return &LintImpl{
+		LintOptions: l,
+	}
+}
+
+// Output returns the output
+func (l *LintImpl) Output() string {
+	return l.LintOptions.Output
+}
+
+// CacheDir returns the cache dir
+func (l *LintImpl) CacheDir() string {
+	return l.LintOptions.CacheDir
+}
@@ -0,0 +1,31 @@
+package config
+
+// LockOptions is the options for the lock command
+type LockOptions struct {
+	// File is the file flag
+	File string
+	// CacheDir is the cache dir flag
+	CacheDir string
+}
+
+// NewLockOptions creates a new LockOptions
+func NewLockOptions() *LockOptions {
+	return &LockOptions{}
+}
+
+// LockImpl is impl for LockOptions
+type LockImpl struct {
+	*LockOptions
+}
+
+// NewLockImpl creates a new LockImpl
+func NewLockImpl(l *LockOptions) *LockImpl {
+	return &LockImpl{
+		LockOptions: l,
+	}
+}
+
+// CacheDir returns the cache dir
+func (l *LockImpl) CacheDir() string {
+	return l.LockOptions.CacheDir
+}
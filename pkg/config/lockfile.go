@@ -0,0 +1,84 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LockFileExt is the extension of the lock file written next to a KCLRun file.
+const LockFileExt = ".lock"
+
+// LockFile records the exact chart version, archive and digest resolved for
+// every repository of a KCLRun file.
+type LockFile struct {
+	Releases []LockedRelease `yaml:"releases"`
+}
+
+// LockedRelease is the chart resolved for a repository. The url, path, chart
+// and constraint fields repeat the repository spec to detect stale entries.
+type LockedRelease struct {
+	Name       string `yaml:"name"`
+	URL        string `yaml:"url,omitempty"`
+	Path       string `yaml:"path,omitempty"`
+	Chart      string `yaml:"chart,omitempty"`
+	Constraint string `yaml:"constraint,omitempty"`
+	Version    string `yaml:"version,omitempty"`
+	ArchiveURL string `yaml:"archiveURL,omitempty"`
+	Digest     string `yaml:"digest,omitempty"`
+}
+
+// LockFilePath returns the path of the lock file of the KCLRun file, e.g.
+// kcl-run.lock for kcl-run.yaml.
+func LockFilePath(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + LockFileExt
+}
+
+// LockFromFile reads the lock file, returning nil when it does not exist.
+func LockFromFile(file string) (*LockFile, error) {
+	data, err := os.ReadFile(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lock LockFile
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// WriteFile writes the lock file.
+func (l *LockFile) WriteFile(file string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// Get returns the locked release of the repository, nil when the lock file
+// has no entry for it.
+func (l *LockFile) Get(name string) *LockedRelease {
+	if l == nil {
+		return nil
+	}
+	for i := range l.Releases {
+		if l.Releases[i].Name == name {
+			return &l.Releases[i]
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the locked release was resolved from the repository
+// as currently written in the KCLRun file.
+func (r *LockedRelease) Matches(repo RepositorySpec) bool {
+	return r.URL == repo.URL && r.Path == repo.Path && r.Chart == repo.Chart && r.Constraint == repo.Version
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLockedReleaseMatches(t *testing.T) {
+	locked := LockedRelease{Name: "app", URL: "https://charts.example.com", Chart: "app", Constraint: "^1.0.0", Version: "1.2.0"}
+	tests := []struct {
+		name string
+		repo RepositorySpec
+		want bool
+	}{
+		{name: "unchanged", repo: RepositorySpec{Name: "app", URL: "https://charts.example.com", Chart: "app", Version: "^1.0.0"}, want: true},
+		{name: "other settings", repo: RepositorySpec{Name: "app", URL: "https://charts.example.com", Chart: "app", Version: "^1.0.0", Namespace: "apps"}, want: true},
+		{name: "constraint", repo: RepositorySpec{Name: "app", URL: "https://charts.example.com", Chart: "app", Version: "^2.0.0"}},
+		{name: "pinned version", repo: RepositorySpec{Name: "app", URL: "https://charts.example.com", Chart: "app", Version: "1.2.0"}},
+		{name: "url", repo: RepositorySpec{Name: "app", URL: "https://mirror.example.com", Chart: "app", Version: "^1.0.0"}},
+		{name: "chart", repo: RepositorySpec{Name: "app", URL: "https://charts.example.com", Chart: "web", Version: "^1.0.0"}},
+		{name: "path", repo: RepositorySpec{Name: "app", Path: "./app"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := locked.Matches(tt.repo); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	file := LockFilePath(filepath.Join(t.TempDir(), "kcl-run.yaml"))
+	if filepath.Base(file) != "kcl-run.lock" {
+		t.Errorf("LockFilePath() = %s, want kcl-run.lock", file)
+	}
+	lock, err := LockFromFile(file)
+	if lock != nil || err != nil {
+		t.Fatalf("LockFromFile() = %v, %v without lock file, want nil", lock, err)
+	}
+	if got := lock.Get("app"); got != nil {
+		t.Errorf("Get() = %+v on a nil lock file", got)
+	}
+
+	want := &LockFile{Releases: []LockedRelease{
+		{Name: "app", Path: "./app-1.0.0.tgz", Version: "1.0.0", Digest: "sha256:0123"},
+		{Name: "web", URL: "oci://registry.example.com/charts/web", Constraint: "~1.0", Version: "1.0.3",
+			ArchiveURL: "oci://registry.example.com/charts/web:1.0.3", Digest: "sha256:4567"},
+	}}
+	if err := want.WriteFile(file); err != nil {
+		t.Fatal(err)
+	}
+	lock, err = LockFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(lock, want) {
+		t.Errorf("LockFromFile() = %+v, want %+v", lock, want)
+	}
+	if got := lock.Get("web"); got == nil || got.Version != "1.0.3" {
+		t.Errorf("Get(web) = %+v", got)
+	}
+	if got := lock.Get("db"); got != nil {
+		t.Errorf("Get(db) = %+v, want nil", got)
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Position is a line and a column of a KCLRun file, starting at 1.
+type Position struct {
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// KCLRunPositions are the positions of the fields of a KCLRun file used to
+// report problems.
+type KCLRunPositions struct {
+	// Source is the position of the spec.source value.
+	Source Position
+	// SourceBlock reports whether spec.source is a block scalar whose content
+	// starts on the line after Source.
+	SourceBlock bool
+	// SourceIndent is the indentation of the content of a block scalar source.
+	SourceIndent int
+	// Repositories are the positions of the repositories in declaration order.
+	Repositories []Position
+}
+
+// PositionsFromFile returns the positions of the fields of the KCLRun file.
+func PositionsFromFile(file string) (*KCLRunPositions, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	positions := &KCLRunPositions{}
+	if len(doc.Content) == 0 {
+		return positions, nil
+	}
+	root := doc.Content[0]
+	if source := mappingValue(mappingValue(root, "spec"), "source"); source != nil {
+		positions.Source = Position{Line: source.Line, Column: source.Column}
+		positions.SourceBlock = source.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0
+		if positions.SourceBlock {
+			positions.SourceIndent = blockIndent(data, source.Line)
+		}
+	}
+	if repos := mappingValue(root, "repositories"); repos != nil && repos.Kind == yaml.SequenceNode {
+		for _, repo := range repos.Content {
+			positions.Repositories = append(positions.Repositories, Position{Line: repo.Line, Column: repo.Column})
+		}
+	}
+	return positions, nil
+}
+
+// Repository returns the position of the i-th repository, the zero position
+// when it is unknown.
+func (p *KCLRunPositions) Repository(i int) Position {
+	if i < len(p.Repositories) {
+		return p.Repositories[i]
+	}
+	return Position{}
+}
+
+// SourcePosition maps a line and a column of the KCL source to the KCLRun file.
+func (p *KCLRunPositions) SourcePosition(line, column int) Position {
+	if p.Source.Line == 0 || line == 0 {
+		return p.Source
+	}
+	if p.SourceBlock {
+		// The block content is indented on the lines after the indicator.
+		return Position{Line: p.Source.Line + line, Column: p.SourceIndent + column}
+	}
+	if line == 1 {
+		return Position{Line: p.Source.Line, Column: p.Source.Column + column}
+	}
+	return Position{Line: p.Source.Line + line - 1, Column: column}
+}
+
+// blockIndent returns the indentation of the first non blank line after the
+// line of a block scalar indicator.
+func blockIndent(data []byte, line int) int {
+	lines := strings.Split(string(data), "\n")
+	for _, l := range lines[min(line, len(lines)):] {
+		if strings.TrimSpace(l) != "" {
+			return len(l) - len(strings.TrimLeft(l, " "))
+		}
+	}
+	return 0
+}
+
+// mappingValue returns the value of key in the mapping node, nil when missing.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSourcePosition(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		// line and column are a position in the KCL source.
+		line, column int
+		want         Position
+	}{
+		{
+			name: "block scalar",
+			data: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+spec:
+  source: |
+    a = 1
+    b = c
+`,
+			line: 2, column: 5,
+			want: Position{Line: 6, Column: 9},
+		},
+		{
+			name: "block scalar after blank lines",
+			data: `spec:
+  source: |-
+
+      a = 1
+`,
+			// The leading blank line is the first line of the source.
+			line: 2, column: 1,
+			want: Position{Line: 4, Column: 7},
+		},
+		{
+			name: "folded block scalar",
+			data: `spec:
+  source: >
+   a = 1
+`,
+			line: 1, column: 1,
+			want: Position{Line: 3, Column: 4},
+		},
+		{
+			name: "inline",
+			data: `spec:
+  source: a = b
+`,
+			line: 1, column: 5,
+			want: Position{Line: 2, Column: 16},
+		},
+		{
+			name: "unknown position",
+			data: `spec:
+  source: |
+    a = 1
+`,
+			want: Position{Line: 2, Column: 11},
+		},
+		{
+			name: "no source",
+			data: `spec: {}
+`,
+			line: 1, column: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "kcl-run.yaml")
+			if err := os.WriteFile(file, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			positions, err := PositionsFromFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := positions.SourcePosition(tt.line, tt.column); got != tt.want {
+				t.Errorf("SourcePosition(%d, %d) = %+v, want %+v", tt.line, tt.column, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockIndent(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		line int
+		want int
+	}{
+		{name: "next line", data: "source: |\n    a = 1\n", line: 1, want: 4},
+		{name: "blank lines", data: "source: |\n\n  \n  a = 1\n", line: 1, want: 2},
+		{name: "empty block", data: "source: |\n", line: 1, want: 0},
+		{name: "line out of range", data: "source: |", line: 3, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := blockIndent([]byte(tt.data), tt.line); got != tt.want {
+				t.Errorf("blockIndent() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepositoryPositions(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "kcl-run.yaml")
+	data := `repositories:
+- name: app
+  path: ./app
+-   name: web
+    path: ./web
+`
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	positions, err := PositionsFromFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Position{{Line: 2, Column: 3}, {Line: 4, Column: 5}, {}}
+	got := []Position{positions.Repository(0), positions.Repository(1), positions.Repository(2)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("repository positions = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+// PostRenderOptions is the options for the post-render command
+type PostRenderOptions struct {
+	// File is the file flag
+	File string
+}
+
+// NewPostRenderOptions creates a new PostRenderOptions
+func NewPostRenderOptions() *PostRenderOptions {
+	return &PostRenderOptions{}
+}
+
+// PostRenderImpl is impl for PostRenderOptions
+type PostRenderImpl struct {
+	*PostRenderOptions
+}
+
+// NewPostRenderImpl creates a new PostRenderImpl
+func NewPostRenderImpl(p *PostRenderOptions) *PostRenderImpl {
+	return &PostRenderImpl{
+		PostRenderOptions: p,
+	}
+}
@@ -2,16 +2,29 @@ package config
 
 // RepositorySpec that defines values for a helm repo
 type RepositorySpec struct {
-	Name            string `yaml:"name,omitempty"`
-	Path            string `yaml:"path,omitempty"`
-	URL             string `yaml:"url,omitempty"`
-	CaFile          string `yaml:"caFile,omitempty"`
-	CertFile        string `yaml:"certFile,omitempty"`
-	KeyFile         string `yaml:"keyFile,omitempty"`
-	Username        string `yaml:"username,omitempty"`
-	Password        string `yaml:"password,omitempty"`
-	Managed         string `yaml:"managed,omitempty"`
-	OCI             bool   `yaml:"oci,omitempty"`
-	PassCredentials string `yaml:"passCredentials,omitempty"`
-	SkipTLSVerify   string `yaml:"skipTLSVerify,omitempty"`
+	Name            string                 `yaml:"name,omitempty"`
+	Path            string                 `yaml:"path,omitempty"`
+	URL             string                 `yaml:"url,omitempty"`
+	Chart           string                 `yaml:"chart,omitempty"`
+	Version         string                 `yaml:"version,omitempty"`
+	CaFile          string                 `yaml:"caFile,omitempty"`
+	CertFile        string                 `yaml:"certFile,omitempty"`
+	KeyFile         string                 `yaml:"keyFile,omitempty"`
+	Username        string                 `yaml:"username,omitempty"`
+	Password        string                 `yaml:"password,omitempty"`
+	Managed         string                 `yaml:"managed,omitempty"`
+	OCI             bool                   `yaml:"oci,omitempty"`
+	PassCredentials bool                   `yaml:"passCredentials,omitempty"`
+	SkipTLSVerify   bool                   `yaml:"skipTLSVerify,omitempty"`
+	PlainHTTP       bool                   `yaml:"plainHTTP,omitempty"`
+	Values          map[string]interface{} `yaml:"values,omitempty"`
+	ValuesFiles     []string               `yaml:"valuesFiles,omitempty"`
+	Set             []string               `yaml:"set,omitempty"`
+	Namespace       string                 `yaml:"namespace,omitempty"`
+	KubeVersion     string                 `yaml:"kubeVersion,omitempty"`
+	APIVersions     []string               `yaml:"apiVersions,omitempty"`
+	Verify          bool                   `yaml:"verify,omitempty"`
+	Keyring         string                 `yaml:"keyring,omitempty"`
+	Labels          map[string]string      `yaml:"labels,omitempty"`
+	Needs           []string               `yaml:"needs,omitempty"`
 }
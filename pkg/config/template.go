@@ -4,6 +4,21 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
+)
+
+const (
+	// PostRendererBeforeKCL runs the post renderer on the Helm output before the KCL transformation.
+	PostRendererBeforeKCL = "before"
+	// PostRendererAfterKCL runs the post renderer on the output of the KCL transformation.
+	PostRendererAfterKCL = "after"
+)
+
+const (
+	// ValidateModeOffline validates the manifests against local JSON schemas.
+	ValidateModeOffline = "offline"
+	// ValidateModeCluster validates the manifests with a server-side dry run on the cluster.
+	ValidateModeCluster = "cluster"
 )
 
 // TemplateOptions is the options for the build command
@@ -22,10 +37,26 @@ type TemplateOptions struct {
 	Concurrency int
 	// Validate is the validate flag
 	Validate bool
+	// ValidateMode is the validate mode flag
+	ValidateMode string
+	// KubeContext is the kube context flag
+	KubeContext string
+	// Kubeconfig is the kubeconfig flag
+	Kubeconfig string
+	// SchemaLocations is the schema location flag
+	SchemaLocations []string
+	// IgnoreMissingSchemas is the ignore missing schemas flag
+	IgnoreMissingSchemas bool
 	// IncludeCRDs is the include crds flag
 	IncludeCRDs bool
+	// CRDsOnly is the crds only flag
+	CRDsOnly bool
 	// SkipTests is the skip tests flag
 	SkipTests bool
+	// NoHooks is the no hooks flag
+	NoHooks bool
+	// Selectors is the selector flag
+	Selectors []string
 	// SkipNeeds is the skip needs flag
 	SkipNeeds bool
 	// IncludeNeeds is the include needs flag
@@ -38,6 +69,34 @@ type TemplateOptions struct {
 	SkipCleanup bool
 	// Propagate '--post-renderer' to helmv3 template and helm install
 	PostRenderer string
+	// PostRendererArgs is the post renderer args flag
+	PostRendererArgs []string
+	// PostRendererStage is the post renderer stage flag
+	PostRendererStage string
+	// Namespace is the namespace flag
+	Namespace string
+	// KubeVersion is the kube version flag
+	KubeVersion string
+	// APIVersions is the api versions flag
+	APIVersions []string
+	// CacheDir is the cache dir flag
+	CacheDir string
+	// IndexTTL is the index ttl flag
+	IndexTTL time.Duration
+	// Offline is the offline flag
+	Offline bool
+	// IgnoreLock is the ignore lock flag
+	IgnoreLock bool
+	// Annotate is the annotate flag
+	Annotate bool
+	// StripAnnotations is the strip annotations flag
+	StripAnnotations bool
+	// Combined is the combined flag
+	Combined bool
+	// Verify is the verify flag
+	Verify bool
+	// Keyring is the keyring flag
+	Keyring string
 }
 
 // NewTemplateOptions creates a new Apply
@@ -67,6 +126,11 @@ func (t *TemplateImpl) IncludeCRDs() bool {
 	return t.TemplateOptions.IncludeCRDs
 }
 
+// CRDsOnly returns the crds only
+func (t *TemplateImpl) CRDsOnly() bool {
+	return t.TemplateOptions.CRDsOnly
+}
+
 // IncludeNeeds returns the include needs
 func (t *TemplateImpl) IncludeNeeds() bool {
 	return t.TemplateOptions.IncludeNeeds || t.IncludeTransitiveNeeds()
@@ -77,6 +141,11 @@ func (t *TemplateImpl) IncludeTransitiveNeeds() bool {
 	return t.TemplateOptions.IncludeTransitiveNeeds
 }
 
+// NoHooks returns the no hooks
+func (t *TemplateImpl) NoHooks() bool {
+	return t.TemplateOptions.NoHooks
+}
+
 // OutputDir returns the output dir
 func (t *TemplateImpl) OutputDir() string {
 	return strings.TrimRight(t.TemplateOptions.OutputDir, fmt.Sprintf("%c", os.PathSeparator))
@@ -102,6 +171,11 @@ func (t *TemplateImpl) SkipDeps() bool {
 	return t.TemplateOptions.SkipDeps
 }
 
+// Selectors returns the selectors
+func (t *TemplateImpl) Selectors() []string {
+	return t.TemplateOptions.Selectors
+}
+
 // SkipNeeds returns the skip needs
 func (t *TemplateImpl) SkipNeeds() bool {
 	if !t.IncludeNeeds() {
@@ -121,6 +195,31 @@ func (t *TemplateImpl) Validate() bool {
 	return t.TemplateOptions.Validate
 }
 
+// ValidateMode returns the validate mode
+func (t *TemplateImpl) ValidateMode() string {
+	return t.TemplateOptions.ValidateMode
+}
+
+// KubeContext returns the kube context
+func (t *TemplateImpl) KubeContext() string {
+	return t.TemplateOptions.KubeContext
+}
+
+// Kubeconfig returns the kubeconfig
+func (t *TemplateImpl) Kubeconfig() string {
+	return t.TemplateOptions.Kubeconfig
+}
+
+// SchemaLocations returns the schema locations
+func (t *TemplateImpl) SchemaLocations() []string {
+	return t.TemplateOptions.SchemaLocations
+}
+
+// IgnoreMissingSchemas returns the ignore missing schemas
+func (t *TemplateImpl) IgnoreMissingSchemas() bool {
+	return t.TemplateOptions.IgnoreMissingSchemas
+}
+
 // Values returns the values
 func (t *TemplateImpl) Values() []string {
 	return t.TemplateOptions.Values
@@ -130,3 +229,73 @@ func (t *TemplateImpl) Values() []string {
 func (t *TemplateImpl) PostRenderer() string {
 	return t.TemplateOptions.PostRenderer
 }
+
+// PostRendererArgs returns the post renderer args
+func (t *TemplateImpl) PostRendererArgs() []string {
+	return t.TemplateOptions.PostRendererArgs
+}
+
+// PostRendererStage returns the post renderer stage
+func (t *TemplateImpl) PostRendererStage() string {
+	return t.TemplateOptions.PostRendererStage
+}
+
+// Namespace returns the namespace
+func (t *TemplateImpl) Namespace() string {
+	return t.TemplateOptions.Namespace
+}
+
+// KubeVersion returns the kube version
+func (t *TemplateImpl) KubeVersion() string {
+	return t.TemplateOptions.KubeVersion
+}
+
+// APIVersions returns the api versions
+func (t *TemplateImpl) APIVersions() []string {
+	return t.TemplateOptions.APIVersions
+}
+
+// CacheDir returns the cache dir
+func (t *TemplateImpl) CacheDir() string {
+	return t.TemplateOptions.CacheDir
+}
+
+// IndexTTL returns the index ttl
+func (t *TemplateImpl) IndexTTL() time.Duration {
+	return t.TemplateOptions.IndexTTL
+}
+
+// Offline returns the offline
+func (t *TemplateImpl) Offline() bool {
+	return t.TemplateOptions.Offline
+}
+
+// IgnoreLock returns the ignore lock
+func (t *TemplateImpl) IgnoreLock() bool {
+	return t.TemplateOptions.IgnoreLock
+}
+
+// Annotate returns the annotate
+func (t *TemplateImpl) Annotate() bool {
+	return t.TemplateOptions.Annotate
+}
+
+// StripAnnotations returns the strip annotations
+func (t *TemplateImpl) StripAnnotations() bool {
+	return t.TemplateOptions.StripAnnotations
+}
+
+// Combined returns the combined
+func (t *TemplateImpl) Combined() bool {
+	return t.TemplateOptions.Combined
+}
+
+// Verify returns the verify
+func (t *TemplateImpl) Verify() bool {
+	return t.TemplateOptions.Verify
+}
+
+// Keyring returns the keyring
+func (t *TemplateImpl) Keyring() string {
+	return t.TemplateOptions.Keyring
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// KCLRunAPIVersion is the API version of the KCLRun files.
+	KCLRunAPIVersion = "krm.kcl.dev/v1alpha1"
+	// KCLRunKind is the kind of the KCLRun files.
+	KCLRunKind = "KCLRun"
+)
+
+// FieldError is a problem at a position of a KCLRun file.
+type FieldError struct {
+	File string
+	Position
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %s", e.File, e.Message)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// decodeKCLRun strictly decodes the KCLRun document of file: unknown fields,
+// including the ones under metadata and spec, values of the wrong type,
+// required fields, the chart source of the repositories and duplicate release
+// names, all the problems being reported with their line and column.
+func decodeKCLRun(file string, data []byte) (*KCLRun, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, &FieldError{File: file, Message: "a KCLRun file must be a YAML mapping"}
+	}
+	root := doc.Content[0]
+	var config KCLRun
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err := decoder.Decode(&config)
+	var typeErr *yaml.TypeError
+	if err != nil && !errors.As(err, &typeErr) {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	var errs []error
+	fieldError := func(node *yaml.Node, format string, args ...interface{}) {
+		errs = append(errs, &FieldError{
+			File:     file,
+			Position: Position{Line: node.Line, Column: node.Column},
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+	if typeErr != nil {
+		for _, msg := range typeErr.Errors {
+			errs = append(errs, decodeError(file, root, msg))
+		}
+	}
+	if v := mappingValue(root, "apiVersion"); v == nil || v.Value == "" {
+		fieldError(root, "apiVersion is required")
+	} else if v.Value != KCLRunAPIVersion {
+		fieldError(v, "apiVersion must be %q, got %q", KCLRunAPIVersion, v.Value)
+	}
+	if v := mappingValue(root, "kind"); v == nil || v.Value == "" {
+		fieldError(root, "kind is required")
+	} else if v.Value != KCLRunKind {
+		fieldError(v, "kind must be %q, got %q", KCLRunKind, v.Value)
+	}
+	if spec := mappingValue(root, "spec"); spec == nil {
+		fieldError(root, "spec is required")
+	} else if v := mappingValue(spec, "source"); v == nil || strings.TrimSpace(v.Value) == "" {
+		fieldError(spec, "spec.source is required")
+	}
+
+	if repos := mappingValue(root, "repositories"); repos != nil && repos.Kind == yaml.SequenceNode {
+		validateRepositories(repos, fieldError)
+	}
+	if len(errs) > 0 {
+		slices.SortStableFunc(errs, func(a, b error) int {
+			return comparePositions(a.(*FieldError).Position, b.(*FieldError).Position)
+		})
+		return nil, errors.Join(errs...)
+	}
+	return &config, nil
+}
+
+// validateRepositories checks the release names and the chart source of the
+// repositories, their fields being checked by the decoder.
+func validateRepositories(repos *yaml.Node, fieldError func(node *yaml.Node, format string, args ...interface{})) {
+	names := map[string]*yaml.Node{}
+	for i, repo := range repos.Content {
+		// The repositories which are not mappings are reported by the decoder.
+		if repo.Kind != yaml.MappingNode {
+			continue
+		}
+		name := mappingValue(repo, "name")
+		if name == nil || name.Value == "" {
+			fieldError(repo, "repositories[%d]: name is required", i)
+		} else if first, ok := names[name.Value]; ok {
+			fieldError(name, "duplicate release name %q, first defined at line %d", name.Value, first.Line)
+		} else {
+			names[name.Value] = name
+		}
+		path, url, chart := mappingValue(repo, "path"), mappingValue(repo, "url"), mappingValue(repo, "chart")
+		// A chart is a source on its own only as a <repo>/<chart> name, without url.
+		var sources []string
+		if path != nil && path.Value != "" {
+			sources = append(sources, "path")
+		}
+		if url != nil && url.Value != "" {
+			sources = append(sources, "url")
+		} else if chart != nil && chart.Value != "" {
+			sources = append(sources, "chart")
+		}
+		switch len(sources) {
+		case 0:
+			fieldError(repo, "repositories[%d]: one of path, url or chart is required", i)
+		case 1:
+		default:
+			fieldError(repo, "repositories[%d]: only one of path, url or chart may be set, got %s", i, strings.Join(sources, " and "))
+		}
+	}
+}
+
+// decodeError returns the FieldError of a yaml.TypeError message such as
+// "line 3: field foo not found in type ...", located by the nodes of the line.
+func decodeError(file string, root *yaml.Node, msg string) error {
+	match := typeErrorPattern.FindStringSubmatch(msg)
+	if match == nil {
+		return &FieldError{File: file, Message: msg}
+	}
+	line, _ := strconv.Atoi(match[1])
+	msg = match[2]
+	var nodes []pathNode
+	walkNodes(root, "", func(n pathNode) {
+		if n.node.Line == line {
+			nodes = append(nodes, n)
+		}
+	})
+	fieldError := func(n *pathNode, format string, args ...interface{}) error {
+		e := &FieldError{File: file, Position: Position{Line: line}, Message: fmt.Sprintf(format, args...)}
+		if n != nil {
+			e.Column = n.node.Column
+		}
+		return e
+	}
+	if match := unknownFieldPattern.FindStringSubmatch(msg); match != nil {
+		for _, n := range nodes {
+			if n.key && n.node.Value == match[1] {
+				parent := n.parent
+				if parent == "" {
+					parent = "KCLRun"
+				}
+				return fieldError(&n, "unknown field %q in %s", match[1], parent)
+			}
+		}
+		return fieldError(nil, "unknown field %q", match[1])
+	}
+	if match := unmarshalPattern.FindStringSubmatch(msg); match != nil {
+		tag, value, goType := match[1], strings.TrimSuffix(match[2], "..."), match[3]
+		for _, n := range nodes {
+			if n.key || !strings.HasPrefix(n.node.Value, value) {
+				continue
+			}
+			if (tag == "!!map") != (n.node.Kind == yaml.MappingNode) || (tag == "!!seq") != (n.node.Kind == yaml.SequenceNode) {
+				continue
+			}
+			return fieldError(&n, "%s must be %s, got %s", n.path, yamlTypeName(goType), strings.TrimPrefix(tag, "!!"))
+		}
+	}
+	return fieldError(nil, "%s", msg)
+}
+
+var (
+	typeErrorPattern    = regexp.MustCompile(`^line (\d+): (.*)$`)
+	unknownFieldPattern = regexp.MustCompile(`^field (\S+) not found in type `)
+	unmarshalPattern    = regexp.MustCompile("^cannot unmarshal (!!\\w+)(?: `(.*)`)? into (.+)$")
+)
+
+// pathNode is a node of a YAML document along with its path, e.g.
+// repositories[0].name.
+type pathNode struct {
+	node *yaml.Node
+	path string
+	// parent is the path of the mapping of a key node.
+	parent string
+	key    bool
+}
+
+// walkNodes calls fn for node and its descendants in document order.
+func walkNodes(node *yaml.Node, path string, fn func(pathNode)) {
+	fn(pathNode{node: node, path: path})
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i]
+			keyPath := key.Value
+			if path != "" {
+				keyPath = path + "." + key.Value
+			}
+			fn(pathNode{node: key, path: keyPath, parent: path, key: true})
+			walkNodes(node.Content[i+1], keyPath, fn)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			walkNodes(item, fmt.Sprintf("%s[%d]", path, i), fn)
+		}
+	}
+}
+
+// comparePositions orders the positions by line and column.
+func comparePositions(a, b Position) int {
+	if a.Line != b.Line {
+		return a.Line - b.Line
+	}
+	return a.Column - b.Column
+}
+
+// yamlTypeName returns the YAML name of the Go type of a decode error.
+func yamlTypeName(goType string) string {
+	switch {
+	case goType == "bool":
+		return "a boolean"
+	case goType == "string":
+		return "a string"
+	case strings.HasPrefix(goType, "int") || strings.HasPrefix(goType, "uint"):
+		return "an integer"
+	case strings.HasPrefix(goType, "float"):
+		return "a number"
+	case strings.HasPrefix(goType, "[]"):
+		return "a list"
+	default:
+		return "a mapping"
+	}
+}
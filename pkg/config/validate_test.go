@@ -0,0 +1,108 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeKCLRun(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "valid",
+			data: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  name: app
+spec:
+  source: a = 1
+repositories:
+- name: app
+  path: ./app
+  oci: false
+`,
+		},
+		{
+			name: "unknown fields",
+			data: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+metadata:
+  nmae: app
+spec:
+  source: a = 1
+  parms: {}
+repos: []
+repositories:
+- name: app
+  path: ./app
+  valueFiles: []
+`,
+			want: []string{
+				`kcl.yaml:4:3: unknown field "nmae" in metadata`,
+				`kcl.yaml:7:3: unknown field "parms" in spec`,
+				`kcl.yaml:8:1: unknown field "repos" in KCLRun`,
+				`kcl.yaml:12:3: unknown field "valueFiles" in repositories[0]`,
+			},
+		},
+		{
+			name: "wrong types",
+			data: `apiVersion: krm.kcl.dev/v1alpha1
+kind: KCLRun
+spec:
+  source: a = 1
+repositories:
+- name: app
+  path: ./app
+  oci: maybe
+  needs: db
+  labels: [a]
+- ./other
+`,
+			want: []string{
+				`kcl.yaml:8:8: repositories[0].oci must be a boolean, got str`,
+				`kcl.yaml:9:10: repositories[0].needs must be a list, got str`,
+				`kcl.yaml:10:11: repositories[0].labels must be a mapping, got seq`,
+				`kcl.yaml:11:3: repositories[1] must be a mapping, got str`,
+			},
+		},
+		{
+			name: "required fields",
+			data: `apiVersion: v1
+kind: KCLRun
+spec: {}
+repositories:
+- path: ./app
+  url: https://charts.example.com/app-0.1.0.tgz
+`,
+			want: []string{
+				`kcl.yaml:1:13: apiVersion must be "krm.kcl.dev/v1alpha1", got "v1"`,
+				`kcl.yaml:3:7: spec.source is required`,
+				`kcl.yaml:5:3: repositories[0]: name is required`,
+				`kcl.yaml:5:3: repositories[0]: only one of path, url or chart may be set, got path and url`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := decodeKCLRun("kcl.yaml", []byte(tt.data))
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if config.Repositories[0].Name != "app" {
+					t.Errorf("repositories were not decoded: %+v", config.Repositories)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if want := strings.Join(tt.want, "\n"); err.Error() != want {
+				t.Errorf("got errors:\n%s\nwant:\n%s", err, want)
+			}
+		})
+	}
+}
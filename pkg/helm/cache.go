@@ -0,0 +1,175 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"helm.sh/helm/v3/pkg/helmpath"
+)
+
+const (
+	// DefaultIndexTTL is how long a cached repository index file is used
+	// before being fetched again.
+	DefaultIndexTTL = 10 * time.Minute
+
+	indexCacheDir = "index"
+	chartCacheDir = "charts"
+)
+
+// DefaultCacheDir returns the default cache directory under the Helm cache home.
+func DefaultCacheDir() string {
+	return helmpath.CachePath("kcl")
+}
+
+// Cache is an on-disk cache of the downloaded chart archives and repository
+// index files. A nil Cache caches nothing.
+type Cache struct {
+	// Dir is the cache directory.
+	Dir string
+	// IndexTTL is how long a cached index file, or the archive of a chart URL
+	// without a version, is used before being fetched again, 0 meaning that
+	// they are always fetched.
+	IndexTTL time.Duration
+	// Offline fails instead of downloading what is missing from the cache.
+	Offline bool
+}
+
+// NewCache returns a cache in dir, the default cache directory being used
+// when dir is empty.
+func NewCache(dir string, indexTTL time.Duration, offline bool) *Cache {
+	if dir == "" {
+		dir = DefaultCacheDir()
+	}
+	return &Cache{Dir: dir, IndexTTL: indexTTL, Offline: offline}
+}
+
+// Clean removes all the cached files, leaving the rest of the cache
+// directory untouched as it may be shared, e.g. set to the Helm cache home.
+func (c *Cache) Clean() error {
+	for _, dir := range []string{indexCacheDir, chartCacheDir} {
+		if err := os.RemoveAll(filepath.Join(c.Dir, dir)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getIndex returns the index file of indexURL from the cache, fetching it
+// when missing or expired.
+func (c *Cache) getIndex(indexURL string, fetch func() ([]byte, error)) ([]byte, error) {
+	if c == nil {
+		return fetch()
+	}
+	return c.get(indexCacheDir, cacheKey(indexURL), ".yaml", func(fi os.FileInfo) bool {
+		return time.Since(fi.ModTime()) < c.IndexTTL
+	}, fetch)
+}
+
+// getChart returns the chart archive identified by the key parts, e.g. its
+// URL, version and digest, from the cache, fetching it when missing.
+func (c *Cache) getChart(fetch func() ([]byte, error), keyParts ...string) ([]byte, error) {
+	if c == nil {
+		return fetch()
+	}
+	return c.get(chartCacheDir, cacheKey(keyParts...), ".tgz", func(os.FileInfo) bool {
+		return true
+	}, fetch)
+}
+
+// getUnversionedChart returns the chart archive at the url from the cache,
+// fetching it again when expired as the archive may change over time.
+func (c *Cache) getUnversionedChart(url string, fetch func() ([]byte, error)) ([]byte, error) {
+	if c == nil {
+		return fetch()
+	}
+	return c.get(chartCacheDir, cacheKey(url, "", ""), ".tgz", func(fi os.FileInfo) bool {
+		return time.Since(fi.ModTime()) < c.IndexTTL
+	}, fetch)
+}
+
+// getProvenance returns the provenance file identified by the key parts, e.g.
+// its URL and the digest of the chart archive, from the cache, fetching it when missing.
+func (c *Cache) getProvenance(fetch func() ([]byte, error), keyParts ...string) ([]byte, error) {
+	if c == nil {
+		return fetch()
+	}
+	return c.get(chartCacheDir, cacheKey(keyParts...), ".prov", func(os.FileInfo) bool {
+		return true
+	}, fetch)
+}
+
+// get returns the cached file when it exists and is fresh, or in offline mode,
+// and otherwise caches the result of fetch.
+func (c *Cache) get(dir, key, ext string, fresh func(os.FileInfo) bool, fetch func() ([]byte, error)) ([]byte, error) {
+	file := filepath.Join(c.Dir, dir, key+ext)
+	fi, err := os.Stat(file)
+	if err == nil && (c.Offline || fresh(fi)) {
+		return os.ReadFile(file)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if c.Offline {
+		return nil, fmt.Errorf("%s is not in the cache %s and offline mode is enabled", key, c.Dir)
+	}
+	data, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(file, data); err != nil {
+		return nil, fmt.Errorf("failed to write the cache: %w", err)
+	}
+	return data, nil
+}
+
+// cacheKey returns the hex SHA-256 of the key parts.
+func cacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic writes data to a temporary file renamed to file, so that
+// concurrent readers never see a partial file.
+func writeFileAtomic(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// pinnedRegistryReference reports whether the OCI reference and version
+// always designate the same chart, i.e. a digest or an exact version tag, so
+// that the pulled chart can be cached. Floating tags such as latest are not.
+func pinnedRegistryReference(ref, version string) bool {
+	name := registryReferenceName(ref)
+	if strings.Contains(name, "@") {
+		return true
+	}
+	tag := version
+	if i := strings.Index(name, ":"); i >= 0 {
+		tag = name[i+1:]
+	}
+	// OCI tags cannot contain "+", Helm pushes the build metadata after a "_".
+	_, err := semver.StrictNewVersion(strings.ReplaceAll(tag, "_", "+"))
+	return err == nil
+}
@@ -0,0 +1,98 @@
+package helm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheClean(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]bool{
+		filepath.Join(indexCacheDir, "index.yaml"): false,
+		filepath.Join(chartCacheDir, "chart.tgz"):  false,
+		filepath.Join("repository", "other.yaml"):  true,
+		"unrelated.txt": true,
+	}
+	for file := range files {
+		if err := writeFileAtomic(filepath.Join(dir, file), []byte("data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := NewCache(dir, 0, false).Clean(); err != nil {
+		t.Fatal(err)
+	}
+	for file, kept := range files {
+		_, err := os.Stat(filepath.Join(dir, file))
+		if kept && err != nil {
+			t.Errorf("%s was removed: %v", file, err)
+		}
+		if !kept && err == nil {
+			t.Errorf("%s was not removed", file)
+		}
+	}
+}
+
+func TestPinnedRegistryReference(t *testing.T) {
+	tests := []struct {
+		ref, version string
+		want         bool
+	}{
+		{ref: "oci://example.com/charts/app", want: false},
+		{ref: "oci://example.com/charts/app:latest", want: false},
+		{ref: "oci://example.com/charts/app:1.2", want: false},
+		{ref: "oci://example.com/charts/app:1.2.3", want: true},
+		{ref: "oci://example.com/charts/app:1.2.3_build.1", want: true},
+		{ref: "oci://example.com:5000/charts/app", version: "1.2.3", want: true},
+		{ref: "oci://example.com/charts/app", version: "^1.2.0", want: false},
+		{ref: "oci://example.com/charts/app", version: "latest", want: false},
+		{ref: "oci://example.com/charts/app@sha256:0123", want: true},
+		{ref: "oci://example.com/charts/app:latest@sha256:0123", want: true},
+	}
+	for _, tt := range tests {
+		if got := pinnedRegistryReference(tt.ref, tt.version); got != tt.want {
+			t.Errorf("pinnedRegistryReference(%q, %q) = %v, want %v", tt.ref, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestFetchRemoteArchiveExpiry(t *testing.T) {
+	var fetches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fetches++
+		fmt.Fprintf(w, "archive %d", fetches)
+	}))
+	defer server.Close()
+	url := server.URL + "/app.tgz"
+
+	r := &Render{Cache: NewCache(t.TempDir(), time.Hour, false)}
+	for i := 0; i < 2; i++ {
+		if _, err := r.fetchRemoteArchive(url, url, "", "", &TLSOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.fetchRemoteArchive(url, url, "1.0.0", "", &TLSOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches != 2 {
+		t.Fatalf("fetched %d times within the ttl, want 2", fetches)
+	}
+
+	// Once expired, only the unversioned archive is fetched again.
+	r.Cache.IndexTTL = 0
+	for i := 0; i < 2; i++ {
+		if _, err := r.fetchRemoteArchive(url, url, "", "", &TLSOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.fetchRemoteArchive(url, url, "1.0.0", "", &TLSOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fetches != 4 {
+		t.Errorf("fetched %d times after the ttl, want 4", fetches)
+	}
+}
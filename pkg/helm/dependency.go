@@ -0,0 +1,55 @@
+package helm
+
+import (
+	"fmt"
+	"io"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+)
+
+// BuildDependencies downloads the dependencies declared in Chart.yaml that are
+// missing from the charts/ directory of a local chart directory, as
+// helm dependency build does. Other sources are packaged with their
+// dependencies and are left untouched.
+func (r *Render) BuildDependencies(source *ChartSource) error {
+	if source.Kind != LocalDirectorySource {
+		return nil
+	}
+	ch, err := loader.LoadDir(source.Path)
+	if err != nil {
+		return err
+	}
+	if len(ch.Metadata.Dependencies) == 0 {
+		return nil
+	}
+	missing := action.CheckDependencies(ch, ch.Metadata.Dependencies)
+	if missing == nil {
+		return nil
+	}
+	// Building would download the missing dependencies.
+	if r.Cache != nil && r.Cache.Offline {
+		return fmt.Errorf("%s has missing dependencies and offline mode is enabled: %w", source, missing)
+	}
+	registryClient, err := newRegistryClient(source.TLSOptions)
+	if err != nil {
+		return err
+	}
+	settings := cli.New()
+	manager := &downloader.Manager{
+		Out:              io.Discard,
+		ChartPath:        source.Path,
+		Keyring:          source.Keyring,
+		Getters:          getter.All(settings),
+		RegistryClient:   registryClient,
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+	}
+	if err := manager.Build(); err != nil {
+		return fmt.Errorf("failed to build the dependencies of %s: %w", source, err)
+	}
+	return nil
+}
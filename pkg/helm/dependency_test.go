@@ -0,0 +1,29 @@
+package helm
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+func TestBuildDependenciesOffline(t *testing.T) {
+	dir := t.TempDir()
+	ch := &chart.Chart{Metadata: &chart.Metadata{
+		APIVersion:   chart.APIVersionV2,
+		Name:         "app",
+		Version:      "0.1.0",
+		Dependencies: []*chart.Dependency{{Name: "db", Version: "1.0.0", Repository: "https://charts.example.com"}},
+	}}
+	if err := chartutil.SaveDir(ch, dir); err != nil {
+		t.Fatal(err)
+	}
+	source := &ChartSource{Kind: LocalDirectorySource, Path: filepath.Join(dir, "app"), TLSOptions: &TLSOptions{}}
+	r := &Render{Cache: NewCache(t.TempDir(), DefaultIndexTTL, true)}
+	err := r.BuildDependencies(source)
+	if err == nil || !strings.Contains(err.Error(), "offline mode") || !strings.Contains(err.Error(), "db") {
+		t.Errorf("BuildDependencies() error = %v, want the missing db dependency reported", err)
+	}
+}
@@ -3,19 +3,26 @@ package helm
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 
-	"io"
 	"log"
-	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 
 	"helm.sh/helm/v3/pkg/action"
 	"helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/release"
 	. "helm.sh/helm/v3/pkg/repo"
 	"helm.sh/helm/v3/pkg/strvals"
+	"sigs.k8s.io/yaml"
 )
 
 const (
@@ -23,37 +30,138 @@ const (
 )
 
 type TemplateRender interface {
-	GenerateManifests(releaseName, namespace string, chart *chart.Chart, values map[string]interface{}) ([]byte, error)
+	GenerateManifests(opts *ReleaseOptions, chart *chart.Chart, values map[string]interface{}) ([]byte, error)
+}
+
+// ReleaseOptions are the per-release settings used to render a chart.
+type ReleaseOptions struct {
+	// Name is the release name.
+	Name string
+	// Namespace is the release namespace.
+	Namespace string
+	// KubeVersion is the Kubernetes version used for .Capabilities.KubeVersion.
+	KubeVersion string
+	// APIVersions are the extra API versions used for .Capabilities.APIVersions.
+	APIVersions []string
+	// IncludeCRDs includes the CRDs of the chart and its subcharts in the manifests.
+	IncludeCRDs bool
+	// CRDsOnly only outputs the CRDs of the chart and its subcharts.
+	CRDsOnly bool
+	// SkipTests skips the test hooks of the chart.
+	SkipTests bool
+	// NoHooks skips all the hooks of the chart.
+	NoHooks bool
 }
 
 type Render struct {
-	// indexFile is the index file of the remote charts.
+	// Cache caches the downloaded charts and index files, nil disables caching.
+	Cache *Cache
+
+	mu sync.Mutex
+	// indexFiles are the index files of the remote chart repositories keyed by
+	// URL and credentials.
+	indexFiles map[string]*indexFileEntry
+}
+
+// indexFileEntry is an index file of a remote chart repository, its mutex
+// being held while it is fetched so that it is fetched once.
+type indexFileEntry struct {
+	mu        sync.Mutex
 	indexFile *IndexFile
 }
 
 var _ TemplateRender = &Render{}
 
-func (r *Render) LoadChartFromRemoteCharts(downloadURL string) (*chart.Chart, error) {
-	rsp, err := http.Get(downloadURL)
+func (r *Render) LoadChartFromRemoteCharts(downloadURL string, opts *TLSOptions) (*chart.Chart, error) {
+	body, err := r.fetchRemoteArchive(downloadURL, downloadURL, "", "", opts)
 	if err != nil {
 		return nil, err
 	}
-	defer rsp.Body.Close()
 
-	body, err := io.ReadAll(rsp.Body)
+	return loader.LoadArchive(bytes.NewReader(body))
+}
+
+// LoadChartFromRepository loads the chart version matching the semver
+// constraint version from the chart repository at repoURL.
+func (r *Render) LoadChartFromRepository(repoURL, chartName, version string, opts *TLSOptions) (*chart.Chart, error) {
+	archive, err := r.fetchRepositoryArchive(repoURL, chartName, version, opts)
 	if err != nil {
 		return nil, err
 	}
+	return loader.LoadArchive(bytes.NewReader(archive.data))
+}
 
-	return loader.LoadArchive(bytes.NewReader(body))
+// fetchRepositoryArchive downloads the archive of the chart version matching
+// the semver constraint version from the chart repository at repoURL.
+func (r *Render) fetchRepositoryArchive(repoURL, chartName, version string, opts *TLSOptions) (*chartArchive, error) {
+	cv, downloadURL, err := r.ResolveChartVersion(repoURL, chartName, version, opts)
+	if err != nil {
+		return nil, err
+	}
+	// The credentials are only sent to the archive when it is served by the
+	// repository host or when PassCredentials is set.
+	body, err := r.fetchRemoteArchive(downloadURL, repoURL, cv.Version, cv.Digest, opts)
+	if err != nil {
+		return nil, fmt.Errorf("chart %s-%s: %w", chartName, cv.Version, err)
+	}
+	return &chartArchive{data: body, url: downloadURL}, nil
+}
+
+// fetchRemoteArchive downloads the chart archive at downloadURL through the
+// cache, checking its digest when known. Without a version nor a digest the
+// archive may change and its cached copy expires as the index files do. The
+// credentials are only sent to the host of baseURL unless PassCredentials is set.
+func (r *Render) fetchRemoteArchive(downloadURL, baseURL, version, digest string, opts *TLSOptions) ([]byte, error) {
+	download := func() ([]byte, error) {
+		body, err := fetch(downloadURL, baseURL, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyDigest(body, digest); err != nil {
+			return nil, fmt.Errorf("%s: %w", downloadURL, err)
+		}
+		return body, nil
+	}
+	if version == "" && digest == "" {
+		return r.Cache.getUnversionedChart(downloadURL, download)
+	}
+	return r.Cache.getChart(download, downloadURL, version, strings.TrimPrefix(digest, "sha256:"))
+}
+
+// ResolveChartVersion resolves the chart version matching the semver
+// constraint version in the index of the chart repository at repoURL, the
+// latest version that is not a prerelease being used when version is empty,
+// like with helm. It returns the chart version and the absolute URL of its
+// archive.
+func (r *Render) ResolveChartVersion(repoURL, chartName, version string, opts *TLSOptions) (*ChartVersion, string, error) {
+	indexFile, err := r.GetIndexFile(strings.TrimSuffix(repoURL, "/")+"/index.yaml", opts)
+	if err != nil {
+		return nil, "", err
+	}
+	cv, err := indexFile.Get(chartName, version)
+	if err == nil && len(cv.URLs) == 0 {
+		err = fmt.Errorf("no download URLs found for %s-%s", chartName, cv.Version)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve chart %q version %q in %s: %w", chartName, version, repoURL, err)
+	}
+	downloadURL, err := ResolveReferenceURL(repoURL, cv.URLs[0])
+	if err != nil {
+		return nil, "", err
+	}
+	return cv, downloadURL, nil
 }
 
 func (r *Render) LoadChartFromLocalDirectory(directory string) (*chart.Chart, error) {
 	return loader.LoadDir(directory)
 }
 
-func (r *Render) GenerateManifests(releaseName, namespace string, chart *chart.Chart, values map[string]interface{}) ([]byte, error) {
-	client, err := r.newHelmClient(releaseName, namespace)
+func (r *Render) GenerateManifests(opts *ReleaseOptions, chart *chart.Chart, values map[string]interface{}) ([]byte, error) {
+	if opts.CRDsOnly {
+		return crdManifests(chart, values)
+	}
+
+	client, err := r.newHelmClient(opts)
 	if err != nil {
 		return nil, err
 	}
@@ -68,10 +176,43 @@ func (r *Render) GenerateManifests(releaseName, namespace string, chart *chart.C
 	if err != nil {
 		return nil, err
 	}
+	// Hooks are part of the output as with helm template, they are recognized
+	// by their helm.sh/hook annotation.
+	for _, h := range rel.Hooks {
+		if opts.NoHooks || (opts.SkipTests && isTestHook(h)) {
+			continue
+		}
+		fmt.Fprintf(&manifests, "---\n# Source: %s\n%s\n", h.Path, h.Manifest)
+	}
 
 	return manifests.Bytes(), nil
 }
 
+// crdManifests returns the CRDs in the crds/ directories of the chart and its
+// enabled subcharts without rendering them, as Helm installs them.
+func crdManifests(chart *chart.Chart, values map[string]interface{}) ([]byte, error) {
+	// Drop the subcharts disabled by their condition or tags as helm install does.
+	if err := chartutil.ProcessDependenciesWithMerge(chart, values); err != nil {
+		return nil, err
+	}
+	var manifests bytes.Buffer
+	for _, crd := range chart.CRDObjects() {
+		fmt.Fprintf(&manifests, "---\n# Source: %s\n%s\n", crd.Filename, strings.TrimSpace(string(crd.File.Data)))
+	}
+	return manifests.Bytes(), nil
+}
+
+/////////////// Source: cmd/helm/template.go /////////////////////////
+
+func isTestHook(h *release.Hook) bool {
+	for _, e := range h.Events {
+		if e == release.HookTest {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Render) GenerateHelmValues(input interface{}) (map[string]interface{}, error) {
 	var rawArgs []string
 	valueOf := reflect.ValueOf(input)
@@ -116,18 +257,34 @@ func (r *Render) GetLatestChart(indexFile *IndexFile, chartName string) (*ChartV
 	return nil, fmt.Errorf("chart %s not found", chartName)
 }
 
-func (r *Render) GetIndexFile(indexURL string) (*IndexFile, error) {
-	if r.indexFile != nil {
-		return r.indexFile, nil
+// GetIndexFile returns the index file at indexURL, fetched once per URL and
+// credentials. Different index files are fetched concurrently.
+func (r *Render) GetIndexFile(indexURL string, opts *TLSOptions) (*IndexFile, error) {
+	key := indexURL
+	if opts != nil {
+		key = cacheKey(indexURL, opts.Username, opts.Password, opts.CertFile, opts.KeyFile, opts.CaFile,
+			strconv.FormatBool(opts.InsecureSkipTLSVerify))
 	}
+	r.mu.Lock()
+	entry, ok := r.indexFiles[key]
+	if !ok {
+		if r.indexFiles == nil {
+			r.indexFiles = map[string]*indexFileEntry{}
+		}
+		entry = &indexFileEntry{}
+		r.indexFiles[key] = entry
+	}
+	r.mu.Unlock()
 
-	rsp, err := http.Get(indexURL)
-	if err != nil {
-		return nil, err
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.indexFile != nil {
+		return entry.indexFile, nil
 	}
-	defer rsp.Body.Close()
 
-	body, err := io.ReadAll(rsp.Body)
+	body, err := r.Cache.getIndex(indexURL, func() ([]byte, error) {
+		return fetch(indexURL, indexURL, opts)
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -138,23 +295,74 @@ func (r *Render) GetIndexFile(indexURL string) (*IndexFile, error) {
 	}
 
 	// Cache the index file, so we don't request the index every time.
-	r.indexFile = indexFile
+	entry.indexFile = indexFile
 
 	return indexFile, nil
 }
 
-func (r *Render) newHelmClient(releaseName, namespace string) (*action.Install, error) {
+func (r *Render) newHelmClient(opts *ReleaseOptions) (*action.Install, error) {
 	helmClient := action.NewInstall(new(action.Configuration))
 	helmClient.DryRun = true
-	helmClient.ReleaseName = releaseName
+	helmClient.ReleaseName = opts.Name
 	helmClient.Replace = true
 	helmClient.ClientOnly = true
-	helmClient.IncludeCRDs = true
-	helmClient.Namespace = namespace
+	helmClient.IncludeCRDs = opts.IncludeCRDs
+	helmClient.DisableHooks = opts.NoHooks
+	helmClient.Namespace = opts.Namespace
+	helmClient.APIVersions = chartutil.VersionSet(opts.APIVersions)
+	if opts.KubeVersion != "" {
+		kubeVersion, err := chartutil.ParseKubeVersion(opts.KubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kube version %q: %w", opts.KubeVersion, err)
+		}
+		helmClient.KubeVersion = kubeVersion
+	}
 
 	return helmClient, nil
 }
 
+// fetch returns the body of href using the TLS and authentication options.
+// The basic authentication credentials are only sent when href has the
+// scheme and the host of baseURL, unless PassCredentials is set.
+func fetch(href, baseURL string, opts *TLSOptions) ([]byte, error) {
+	if opts == nil {
+		opts = &TLSOptions{}
+	}
+	g, err := getter.NewHTTPGetter(
+		getter.WithURL(baseURL),
+		getter.WithTLSClientConfig(opts.CertFile, opts.KeyFile, opts.CaFile),
+		getter.WithInsecureSkipVerifyTLS(opts.InsecureSkipTLSVerify),
+		getter.WithBasicAuth(opts.Username, opts.Password),
+		getter.WithPassCredentialsAll(opts.PassCredentials),
+	)
+	if err != nil {
+		return nil, err
+	}
+	body, err := g.Get(href)
+	if err != nil {
+		return nil, err
+	}
+	return body.Bytes(), nil
+}
+
+// verifyDigest checks that data has the hex SHA-256 digest, optionally
+// prefixed with "sha256:", an empty digest being not checked.
+func verifyDigest(data []byte, digest string) error {
+	if digest == "" {
+		return nil
+	}
+	if actual := digestOf(data); strings.TrimPrefix(actual, "sha256:") != strings.TrimPrefix(digest, "sha256:") {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+	}
+	return nil
+}
+
+// digestOf returns the "sha256:<hex>" digest of data.
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
 // loadIndex is from 'helm/pkg/index.go'.
 func loadIndex(data []byte, source string) (*IndexFile, error) {
 	i := &IndexFile{}
@@ -163,12 +371,21 @@ func loadIndex(data []byte, source string) (*IndexFile, error) {
 		return i, ErrEmptyIndexYaml
 	}
 
+	if err := jsonOrYamlUnmarshal(data, i); err != nil {
+		return i, fmt.Errorf("failed to load index %s: %w", source, err)
+	}
+
 	for name, cvs := range i.Entries {
 		for idx := len(cvs) - 1; idx >= 0; idx-- {
 			if cvs[idx] == nil {
 				log.Printf("skipping loading invalid entry for chart %q from %s: empty entry", name, source)
+				cvs = append(cvs[:idx], cvs[idx+1:]...)
 				continue
 			}
+			// When metadata section missing, initialize with no data
+			if cvs[idx].Metadata == nil {
+				cvs[idx].Metadata = &chart.Metadata{}
+			}
 			if cvs[idx].APIVersion == "" {
 				cvs[idx].APIVersion = chart.APIVersionV1
 			}
@@ -177,6 +394,8 @@ func loadIndex(data []byte, source string) (*IndexFile, error) {
 				cvs = append(cvs[:idx], cvs[idx+1:]...)
 			}
 		}
+		// adjust slice to only contain a set of valid versions
+		i.Entries[name] = cvs
 	}
 	i.SortEntries()
 	if i.APIVersion == "" {
@@ -184,3 +403,11 @@ func loadIndex(data []byte, source string) (*IndexFile, error) {
 	}
 	return i, nil
 }
+
+// jsonOrYamlUnmarshal is from 'helm/pkg/index.go'.
+func jsonOrYamlUnmarshal(b []byte, i interface{}) error {
+	if json.Valid(b) {
+		return json.Unmarshal(b, i)
+	}
+	return yaml.UnmarshalStrict(b, i)
+}
@@ -0,0 +1,179 @@
+package helm
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"helm.sh/helm/v3/pkg/chart"
+)
+
+func TestGenerateManifestsCRDsOnly(t *testing.T) {
+	newChart := func() *chart.Chart {
+		sub := &chart.Chart{
+			Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: "sub", Version: "0.1.0"},
+			Files:    []*chart.File{{Name: "crds/gadgets.yaml", Data: []byte("kind: CustomResourceDefinition\nmetadata:\n  name: gadgets.example.com\n")}},
+		}
+		parent := &chart.Chart{
+			Metadata: &chart.Metadata{
+				APIVersion:   chart.APIVersionV2,
+				Name:         "parent",
+				Version:      "0.1.0",
+				Dependencies: []*chart.Dependency{{Name: "sub", Version: "0.1.0", Condition: "sub.enabled"}},
+			},
+			Files:  []*chart.File{{Name: "crds/widgets.yaml", Data: []byte("kind: CustomResourceDefinition\nmetadata:\n  name: widgets.example.com\n")}},
+			Values: map[string]interface{}{"sub": map[string]interface{}{"enabled": true}},
+		}
+		parent.SetDependencies(sub)
+		return parent
+	}
+	tests := []struct {
+		name   string
+		values map[string]interface{}
+		want   []string
+	}{
+		{
+			name: "default values",
+			want: []string{"widgets.example.com", "gadgets.example.com"},
+		},
+		{
+			name:   "disabled subchart",
+			values: map[string]interface{}{"sub": map[string]interface{}{"enabled": false}},
+			want:   []string{"widgets.example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Render{}
+			manifests, err := r.GenerateManifests(&ReleaseOptions{CRDsOnly: true}, newChart(), tt.values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Count(string(manifests), "kind: CustomResourceDefinition"); got != len(tt.want) {
+				t.Errorf("got %d CRDs, want %d:\n%s", got, len(tt.want), manifests)
+			}
+			for _, name := range tt.want {
+				if !strings.Contains(string(manifests), "name: "+name) {
+					t.Errorf("missing CRD %s:\n%s", name, manifests)
+				}
+			}
+		})
+	}
+}
+
+func TestGetIndexFile(t *testing.T) {
+	var mu sync.Mutex
+	fetches := map[string]int{}
+	// The index of /slow is served once /fast has been requested, which only
+	// happens when the index files are fetched concurrently.
+	fastRequested := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, _, _ := req.BasicAuth()
+		mu.Lock()
+		fetches[req.URL.Path+" "+user]++
+		mu.Unlock()
+		switch req.URL.Path {
+		case "/fast/index.yaml":
+			close(fastRequested)
+		case "/slow/index.yaml":
+			select {
+			case <-fastRequested:
+			case <-time.After(5 * time.Second):
+				w.WriteHeader(http.StatusGatewayTimeout)
+				return
+			}
+		}
+		fmt.Fprint(w, "apiVersion: v1\nentries: {}\n")
+	}))
+	defer server.Close()
+
+	r := &Render{}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	get := func(path, user string) {
+		defer wg.Done()
+		if _, err := r.GetIndexFile(server.URL+path, &TLSOptions{Username: user, Password: "secret"}); err != nil {
+			errs <- err
+		}
+	}
+	for i := 0; i < 3; i++ {
+		wg.Add(2)
+		go get("/slow/index.yaml", "alice")
+		go get("/slow/index.yaml", "bob")
+	}
+	// Let the slow fetches start before the fast one.
+	time.Sleep(50 * time.Millisecond)
+	wg.Add(1)
+	go get("/fast/index.yaml", "alice")
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	want := map[string]int{
+		"/slow/index.yaml alice": 1,
+		"/slow/index.yaml bob":   1,
+		"/fast/index.yaml alice": 1,
+	}
+	if !reflect.DeepEqual(fetches, want) {
+		t.Errorf("fetches = %v, want %v", fetches, want)
+	}
+}
+
+func TestResolveChartVersion(t *testing.T) {
+	const index = `apiVersion: v1
+entries:
+  app:
+  - name: app
+    version: 1.0.0
+    urls: [app-1.0.0.tgz]
+  - name: app
+    version: 1.1.0-rc.1
+    urls: [app-1.1.0-rc.1.tgz]
+  - name: app
+    version: 0.9.0
+    urls: [https://charts.example.com/app-0.9.0.tgz]
+`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprint(w, index)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		version     string
+		wantVersion string
+		wantURL     string
+		wantErr     bool
+	}{
+		// Prereleases are only resolved when asked for, like with helm.
+		{version: "", wantVersion: "1.0.0", wantURL: server.URL + "/app-1.0.0.tgz"},
+		{version: "1.1.0-rc.1", wantVersion: "1.1.0-rc.1", wantURL: server.URL + "/app-1.1.0-rc.1.tgz"},
+		{version: ">=1.1.0-0", wantVersion: "1.1.0-rc.1", wantURL: server.URL + "/app-1.1.0-rc.1.tgz"},
+		{version: "<1.0.0", wantVersion: "0.9.0", wantURL: "https://charts.example.com/app-0.9.0.tgz"},
+		{version: "2.x", wantErr: true},
+	}
+	r := &Render{}
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			cv, url, err := r.ResolveChartVersion(server.URL, "app", tt.version, &TLSOptions{})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got version %s", cv.Version)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cv.Version != tt.wantVersion || url != tt.wantURL {
+				t.Errorf("got %s at %s, want %s at %s", cv.Version, url, tt.wantVersion, tt.wantURL)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/lint"
+	"helm.sh/helm/v3/pkg/lint/support"
+)
+
+// LintChart runs the Helm chart linter on the chart of the source with the
+// release values. Archives are expanded to a temporary directory first, the
+// paths of the messages being relative to the chart directory.
+func (r *Render) LintChart(source *ChartSource, opts *ReleaseOptions, values map[string]interface{}) ([]support.Message, error) {
+	var kubeVersion *chartutil.KubeVersion
+	if opts.KubeVersion != "" {
+		v, err := chartutil.ParseKubeVersion(opts.KubeVersion)
+		if err != nil {
+			return nil, fmt.Errorf("invalid kube version %q: %w", opts.KubeVersion, err)
+		}
+		kubeVersion = v
+	}
+	chartPath := source.Path
+	if source.Kind != LocalDirectorySource {
+		archive, err := r.fetchArchive(source)
+		if err != nil {
+			return nil, err
+		}
+		ch, err := loader.LoadArchive(bytes.NewReader(archive.data))
+		if err != nil {
+			return nil, err
+		}
+		dir, err := os.MkdirTemp("", "helm-kcl-lint-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(dir)
+		if err := chartutil.Expand(dir, bytes.NewReader(archive.data)); err != nil {
+			return nil, err
+		}
+		chartPath = filepath.Join(dir, ch.Name())
+	}
+	return lint.AllWithKubeVersion(chartPath, values, opts.Namespace, kubeVersion).Messages, nil
+}
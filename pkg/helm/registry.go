@@ -0,0 +1,115 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+// LoadChartFromRegistry pulls the chart of the oci:// reference ref, which may
+// carry a tag or a digest, and loads it. When version is set it selects the
+// tag, semver constraints being resolved against the tags of the repository.
+func (r *Render) LoadChartFromRegistry(ref, version string, opts *TLSOptions) (*chart.Chart, error) {
+	archive, err := r.pullRegistryArchive(ref, version, opts)
+	if err != nil {
+		return nil, err
+	}
+	return loader.LoadArchive(bytes.NewReader(archive.data))
+}
+
+// pullRegistryArchive pulls the chart archive of the oci:// reference ref
+// through the cache. The archive url is the reference with the pulled tag or digest.
+func (r *Render) pullRegistryArchive(ref, version string, opts *TLSOptions) (*chartArchive, error) {
+	archive := &chartArchive{url: ref}
+	pull := func() ([]byte, error) {
+		client, err := newRegistryClient(opts)
+		if err != nil {
+			return nil, err
+		}
+		pullRef, err := resolveRegistryReference(client, ref, version)
+		if err != nil {
+			return nil, err
+		}
+		result, err := client.Pull(pullRef, registry.PullOptWithChart(true))
+		if err != nil {
+			return nil, fmt.Errorf("failed to pull %s: %w", pullRef, err)
+		}
+		archive.url = pullRef
+		return result.Chart.Data, nil
+	}
+	var err error
+	// Floating tags and version constraints are always resolved against the registry.
+	if pinnedRegistryReference(ref, version) {
+		if version != "" && !hasTagOrDigest(ref) {
+			archive.url = fmt.Sprintf("%s:%s", ref, version)
+		}
+		archive.data, err = r.Cache.getChart(pull, ref, version)
+	} else if r.Cache != nil && r.Cache.Offline {
+		err = fmt.Errorf("%s version %q must be pinned to a digest or an exact version in offline mode", ref, version)
+	} else {
+		archive.data, err = pull()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// resolveRegistryReference returns the registry reference with the tag or the
+// digest to pull, as the Helm chart downloader does for OCI charts.
+func resolveRegistryReference(client *registry.Client, ref, version string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid chart reference %q: %w", ref, err)
+	}
+	u, err = client.ValidateReference(ref, version, u)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve chart reference %q version %q: %w", ref, version, err)
+	}
+	return u.String(), nil
+}
+
+// newRegistryClient returns a registry client honoring the TLS and basic
+// authentication options, falling back to the Helm registry credentials.
+func newRegistryClient(opts *TLSOptions) (*registry.Client, error) {
+	tlsConfig, err := newTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	clientOpts := []registry.ClientOption{
+		registry.ClientOptEnableCache(true),
+		registry.ClientOptWriter(io.Discard),
+		registry.ClientOptCredentialsFile(cli.New().RegistryConfig),
+		registry.ClientOptHTTPClient(&http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: tlsConfig,
+				Proxy:           http.ProxyFromEnvironment,
+			},
+		}),
+	}
+	if opts.Username != "" && opts.Password != "" {
+		clientOpts = append(clientOpts, registry.ClientOptBasicAuth(opts.Username, opts.Password))
+	}
+	if opts.PlainHTTP {
+		clientOpts = append(clientOpts, registry.ClientOptPlainHTTP())
+	}
+	return registry.NewClient(clientOpts...)
+}
+
+// registryReferenceName returns the last path element of the oci:// reference.
+func registryReferenceName(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+// hasTagOrDigest reports whether the oci:// reference carries a tag or a digest.
+func hasTagOrDigest(ref string) bool {
+	return strings.ContainsAny(registryReferenceName(ref), ":@")
+}
@@ -0,0 +1,230 @@
+package helm
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
+
+// testRegistry is a minimal in-process OCI distribution registry serving
+// plain http, enough for the Helm registry client to push and pull charts.
+type testRegistry struct {
+	username, password string
+
+	mu        sync.Mutex
+	blobs     map[string][]byte
+	manifests map[string]testManifest
+	tags      map[string][]string
+	uploads   map[string][]byte
+	nextID    int
+}
+
+type testManifest struct {
+	mediaType string
+	data      []byte
+}
+
+func newTestRegistry(username, password string) *testRegistry {
+	return &testRegistry{
+		username:  username,
+		password:  password,
+		blobs:     map[string][]byte{},
+		manifests: map[string]testManifest{},
+		tags:      map[string][]string{},
+		uploads:   map[string][]byte{},
+	}
+}
+
+func testDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (reg *testRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if reg.username != "" {
+		if u, p, ok := req.BasicAuth(); !ok || u != reg.username || p != reg.password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+
+	path := strings.TrimPrefix(req.URL.Path, "/v2/")
+	if path == "" || path == "/v2" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	body, _ := io.ReadAll(req.Body)
+	switch {
+	case strings.Contains(path, "/blobs/uploads/"):
+		repo, id, _ := strings.Cut(path, "/blobs/uploads/")
+		reg.serveUpload(w, req, repo, id, body)
+	case strings.Contains(path, "/blobs/"):
+		_, digest, _ := strings.Cut(path, "/blobs/")
+		data, ok := reg.blobs[digest]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Header().Set("Docker-Content-Digest", digest)
+		if req.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+	case strings.Contains(path, "/manifests/"):
+		repo, ref, _ := strings.Cut(path, "/manifests/")
+		reg.serveManifest(w, req, repo, ref, body)
+	case strings.HasSuffix(path, "/tags/list"):
+		repo := strings.TrimSuffix(path, "/tags/list")
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"name": repo, "tags": reg.tags[repo]})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (reg *testRegistry) serveUpload(w http.ResponseWriter, req *http.Request, repo, id string, body []byte) {
+	if req.Method == http.MethodPost {
+		reg.nextID++
+		id = fmt.Sprint(reg.nextID)
+	}
+	data := append(reg.uploads[id], body...)
+	digest := req.URL.Query().Get("digest")
+	if digest == "" {
+		reg.uploads[id] = data
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/%s", repo, id))
+		w.Header().Set("Range", fmt.Sprintf("0-%d", max(len(data)-1, 0)))
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	delete(reg.uploads, id)
+	if testDigest(data) != digest {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	reg.blobs[digest] = data
+	w.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/%s", repo, digest))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (reg *testRegistry) serveManifest(w http.ResponseWriter, req *http.Request, repo, ref string, body []byte) {
+	if req.Method == http.MethodPut {
+		digest := testDigest(body)
+		m := testManifest{mediaType: req.Header.Get("Content-Type"), data: body}
+		reg.manifests[repo+"@"+digest] = m
+		if !strings.HasPrefix(ref, "sha256:") {
+			reg.manifests[repo+":"+ref] = m
+			reg.tags[repo] = append(reg.tags[repo], ref)
+		}
+		w.Header().Set("Location", fmt.Sprintf("/v2/%s/manifests/%s", repo, digest))
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	key := repo + ":" + ref
+	if strings.HasPrefix(ref, "sha256:") {
+		key = repo + "@" + ref
+	}
+	m, ok := reg.manifests[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", m.mediaType)
+	w.Header().Set("Content-Length", fmt.Sprint(len(m.data)))
+	w.Header().Set("Docker-Content-Digest", testDigest(m.data))
+	if req.Method == http.MethodGet {
+		_, _ = w.Write(m.data)
+	}
+}
+
+// testChartArchive returns the archive of a minimal chart.
+func testChartArchive(t *testing.T, name, version string) []byte {
+	t.Helper()
+	ch := &chart.Chart{
+		Metadata: &chart.Metadata{APIVersion: chart.APIVersionV2, Name: name, Version: version},
+		Templates: []*chart.File{{
+			Name: "templates/configmap.yaml",
+			Data: []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\n"),
+		}},
+	}
+	path, err := chartutil.Save(ch, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestLoadChartFromRegistry(t *testing.T) {
+	t.Setenv("HELM_REGISTRY_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	tests := []struct {
+		name               string
+		username, password string
+	}{
+		{name: "anonymous"},
+		{name: "basic auth", username: "user", password: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(newTestRegistry(tt.username, tt.password))
+			defer server.Close()
+			host := strings.TrimPrefix(server.URL, "http://")
+			opts := &TLSOptions{PlainHTTP: true, Username: tt.username, Password: tt.password}
+
+			client, err := newRegistryClient(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pushed, err := client.Push(testChartArchive(t, "mychart", "0.1.0"), host+"/charts/mychart:0.1.0")
+			if err != nil {
+				t.Fatalf("push: %v", err)
+			}
+
+			ref := "oci://" + host + "/charts/mychart"
+			pulls := []struct {
+				name, ref, version string
+			}{
+				{name: "version", ref: ref, version: "0.1.0"},
+				{name: "tag", ref: ref + ":0.1.0"},
+				{name: "digest", ref: ref + "@" + pushed.Manifest.Digest},
+			}
+			for _, pull := range pulls {
+				r := &Render{}
+				ch, err := r.LoadChartFromRegistry(pull.ref, pull.version, opts)
+				if err != nil {
+					t.Fatalf("pull by %s: %v", pull.name, err)
+				}
+				if ch.Metadata.Name != "mychart" || ch.Metadata.Version != "0.1.0" {
+					t.Errorf("pull by %s: got chart %s-%s", pull.name, ch.Metadata.Name, ch.Metadata.Version)
+				}
+			}
+
+			if tt.username != "" {
+				r := &Render{}
+				if _, err := r.LoadChartFromRegistry(ref, "0.1.0", &TLSOptions{PlainHTTP: true}); err == nil {
+					t.Error("pull without credentials: expected an error")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,329 @@
+package helm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/repo"
+)
+
+// SourceKind is the kind of location a chart is loaded from.
+type SourceKind string
+
+const (
+	// LocalDirectorySource is an unpacked chart directory.
+	LocalDirectorySource SourceKind = "local directory"
+	// LocalArchiveSource is a chart archive on the local disk.
+	LocalArchiveSource SourceKind = "local archive"
+	// RemoteArchiveSource is a chart archive served over http(s).
+	RemoteArchiveSource SourceKind = "remote archive"
+	// OCISource is a chart in an OCI registry.
+	OCISource SourceKind = "oci reference"
+	// RepositorySource is a chart resolved from the index of a chart repository.
+	RepositorySource SourceKind = "repository chart"
+)
+
+// ChartReference describes where a chart lives as written in a KCLRun file.
+type ChartReference struct {
+	// Path is a local chart directory or archive.
+	Path string
+	// URL is a chart archive URL, an oci:// reference or a chart repository URL.
+	URL string
+	// Chart is the chart name in the repository at URL, or a <repo>/<chart>
+	// name of the Helm repositories file when URL is empty.
+	Chart string
+	// Version is the chart version or semver constraint.
+	Version string
+	// OCI forces URL to be treated as an OCI reference.
+	OCI bool
+	// TLSOptions are the TLS and authentication settings of the remote sources.
+	TLSOptions *TLSOptions
+	// Verify checks the provenance file of the chart archive before loading it.
+	Verify bool
+	// Keyring is the keyring containing the public keys used for verification.
+	Keyring string
+}
+
+// ChartSource is a resolved chart location.
+type ChartSource struct {
+	// Kind is the kind of the location.
+	Kind SourceKind
+	// Path is the local directory or archive.
+	Path string
+	// URL is the archive URL, the oci:// reference or the repository URL.
+	URL string
+	// Chart is the chart name in the repository.
+	Chart string
+	// Version is the chart version or semver constraint.
+	Version string
+	// TLSOptions are the TLS and authentication settings of remote sources.
+	TLSOptions *TLSOptions
+	// Verify checks the provenance file of the chart archive before loading it.
+	Verify bool
+	// Keyring is the keyring containing the public keys used for verification.
+	Keyring string
+}
+
+// String returns a human readable description of the source.
+func (s *ChartSource) String() string {
+	switch s.Kind {
+	case LocalDirectorySource, LocalArchiveSource:
+		return fmt.Sprintf("%s %s", s.Kind, s.Path)
+	case RepositorySource:
+		return fmt.Sprintf("%s %s in %s", s.Kind, s.Chart, s.URL)
+	default:
+		return fmt.Sprintf("%s %s", s.Kind, s.URL)
+	}
+}
+
+// ResolveChartSource resolves the location of the chart reference, trying in
+// order a local directory or archive for Path, and an OCI reference, a chart
+// repository or an http(s) archive for URL. A Chart without URL is looked up
+// as <repo>/<chart> in the Helm repositories file. The error lists what was tried.
+func ResolveChartSource(ref *ChartReference) (*ChartSource, error) {
+	tlsOpts := ref.TLSOptions
+	if tlsOpts == nil {
+		tlsOpts = &TLSOptions{}
+	}
+	source := &ChartSource{
+		Path:       ref.Path,
+		URL:        ref.URL,
+		Chart:      ref.Chart,
+		Version:    ref.Version,
+		TLSOptions: tlsOpts,
+		Verify:     ref.Verify,
+		Keyring:    ref.Keyring,
+	}
+	switch {
+	case ref.Path != "" && ref.URL != "":
+		return nil, errors.New("path and url are mutually exclusive")
+	case ref.Path != "":
+		return resolveLocalSource(source)
+	case ref.URL != "":
+		return resolveRemoteSource(source, ref.OCI)
+	case ref.Chart != "":
+		return resolveRepositoryChart(source)
+	default:
+		return nil, errors.New("no valid helm chart source, it should be a local path, a url or a <repo>/<chart> name")
+	}
+}
+
+func resolveLocalSource(source *ChartSource) (*ChartSource, error) {
+	fi, err := os.Stat(source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("chart %q not found: tried %s and %s: %w",
+			source.Path, LocalDirectorySource, LocalArchiveSource, err)
+	}
+	if fi.IsDir() {
+		if source.Verify {
+			return nil, fmt.Errorf("chart %q is a %s, unpacked charts cannot be verified", source.Path, LocalDirectorySource)
+		}
+		source.Kind = LocalDirectorySource
+		return source, nil
+	}
+	if isArchive(source.Path) {
+		source.Kind = LocalArchiveSource
+		return source, nil
+	}
+	return nil, fmt.Errorf("chart %q is neither a %s nor a %s (.tgz or .tar.gz)",
+		source.Path, LocalDirectorySource, LocalArchiveSource)
+}
+
+func resolveRemoteSource(source *ChartSource, oci bool) (*ChartSource, error) {
+	if oci || registry.IsOCI(source.URL) {
+		ref := source.URL
+		if !registry.IsOCI(ref) {
+			ref = fmt.Sprintf("%s://%s", registry.OCIScheme, ref)
+		}
+		if source.Chart != "" {
+			ref = strings.TrimSuffix(ref, "/") + "/" + source.Chart
+			source.Chart = ""
+		}
+		source.Kind = OCISource
+		source.URL = ref
+		return source, nil
+	}
+	u, err := url.Parse(source.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chart url %q: %w", source.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("chart url %q not supported: tried %s (oci://), %s and %s (http:// or https://)",
+			source.URL, OCISource, RepositorySource, RemoteArchiveSource)
+	}
+	if source.Chart != "" {
+		source.Kind = RepositorySource
+	} else {
+		source.Kind = RemoteArchiveSource
+	}
+	return source, nil
+}
+
+// resolveRepositoryChart resolves a <repo>/<chart> name from the repositories
+// added with "helm repo add", using the credentials of the repository entry
+// when the reference has none.
+func resolveRepositoryChart(source *ChartSource) (*ChartSource, error) {
+	repoName, chartName, ok := strings.Cut(source.Chart, "/")
+	if !ok || repoName == "" || chartName == "" {
+		return nil, fmt.Errorf("chart %q not supported without a path or a url: tried %s <repo>/<chart>", source.Chart, RepositorySource)
+	}
+	repositoryConfig := cli.New().RepositoryConfig
+	file, err := repo.LoadFile(repositoryConfig)
+	if err != nil {
+		return nil, fmt.Errorf("chart %q not found: tried %s in %s: %w", source.Chart, RepositorySource, repositoryConfig, err)
+	}
+	entry := file.Get(repoName)
+	if entry == nil {
+		return nil, fmt.Errorf("chart %q not found: tried %s, no repository named %q in %s", source.Chart, RepositorySource, repoName, repositoryConfig)
+	}
+	if *source.TLSOptions == (TLSOptions{}) {
+		source.TLSOptions = &TLSOptions{
+			CaFile:                entry.CAFile,
+			CertFile:              entry.CertFile,
+			KeyFile:               entry.KeyFile,
+			Username:              entry.Username,
+			Password:              entry.Password,
+			PassCredentials:       entry.PassCredentialsAll,
+			InsecureSkipTLSVerify: entry.InsecureSkipTLSverify,
+		}
+	}
+	source.Kind = RepositorySource
+	source.URL = entry.URL
+	source.Chart = chartName
+	return source, nil
+}
+
+func isArchive(path string) bool {
+	return strings.HasSuffix(path, ".tgz") || strings.HasSuffix(path, ".tar.gz")
+}
+
+// chartArchive is the data of a chart archive with the location it was
+// resolved to: the archive URL, the pinned oci:// reference or the local path.
+type chartArchive struct {
+	data []byte
+	url  string
+}
+
+// LoadChart loads the chart from the resolved source.
+func (r *Render) LoadChart(source *ChartSource) (*chart.Chart, error) {
+	if source.Kind == LocalDirectorySource {
+		return r.LoadChartFromLocalDirectory(source.Path)
+	}
+	archive, err := r.fetchArchive(source)
+	if err != nil {
+		return nil, err
+	}
+	return loader.LoadArchive(bytes.NewReader(archive.data))
+}
+
+// fetchArchive returns the verified chart archive of an archive, OCI or
+// repository source.
+func (r *Render) fetchArchive(source *ChartSource) (*chartArchive, error) {
+	archive, err := r.fetchUnverifiedArchive(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.verifyArchive(source, archive); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+func (r *Render) fetchUnverifiedArchive(source *ChartSource) (*chartArchive, error) {
+	switch source.Kind {
+	case LocalArchiveSource:
+		data, err := os.ReadFile(source.Path)
+		if err != nil {
+			return nil, err
+		}
+		return &chartArchive{data: data, url: source.Path}, nil
+	case RemoteArchiveSource:
+		data, err := r.fetchRemoteArchive(source.URL, source.URL, "", "", source.TLSOptions)
+		if err != nil {
+			return nil, err
+		}
+		return &chartArchive{data: data, url: source.URL}, nil
+	case OCISource:
+		return r.pullRegistryArchive(source.URL, source.Version, source.TLSOptions)
+	case RepositorySource:
+		return r.fetchRepositoryArchive(source.URL, source.Chart, source.Version, source.TLSOptions)
+	default:
+		return nil, fmt.Errorf("%s has no chart archive", source)
+	}
+}
+
+// ChartLock pins a chart source to an exact version, archive and digest.
+type ChartLock struct {
+	// Version is the exact chart version.
+	Version string
+	// ArchiveURL is the archive URL, the pinned oci:// reference or the local archive path.
+	ArchiveURL string
+	// Digest is the "sha256:<hex>" digest of the chart archive.
+	Digest string
+}
+
+// LockChart resolves the source to an exact version, archive and digest.
+// Local directories have no archive and return a nil lock.
+func (r *Render) LockChart(source *ChartSource) (*ChartLock, error) {
+	if source.Kind == LocalDirectorySource {
+		return nil, nil
+	}
+	archive, err := r.fetchArchive(source)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := loader.LoadArchive(bytes.NewReader(archive.data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", source, err)
+	}
+	lock := &ChartLock{
+		Version:    ch.Metadata.Version,
+		ArchiveURL: archive.url,
+		Digest:     digestOf(archive.data),
+	}
+	// Local archives are located by their path in the KCLRun file.
+	if source.Kind == LocalArchiveSource {
+		lock.ArchiveURL = ""
+	}
+	return lock, nil
+}
+
+// LoadLockedChart loads the chart archive pinned by lock instead of resolving
+// the source again, failing when its digest does not match the lock.
+func (r *Render) LoadLockedChart(source *ChartSource, lock *ChartLock) (*chart.Chart, error) {
+	if lock == nil || source.Kind == LocalDirectorySource {
+		return r.LoadChart(source)
+	}
+	archive := &chartArchive{url: lock.ArchiveURL}
+	var err error
+	switch source.Kind {
+	case LocalArchiveSource:
+		archive.url = source.Path
+		archive.data, err = os.ReadFile(source.Path)
+	case RemoteArchiveSource, RepositorySource:
+		// The credentials are only sent to the host of the source url unless PassCredentials is set.
+		archive.data, err = r.fetchRemoteArchive(lock.ArchiveURL, source.URL, lock.Version, lock.Digest, source.TLSOptions)
+	case OCISource:
+		archive, err = r.pullRegistryArchive(lock.ArchiveURL, "", source.TLSOptions)
+	default:
+		err = fmt.Errorf("%s cannot be locked", source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyDigest(archive.data, lock.Digest); err != nil {
+		return nil, fmt.Errorf("%s does not match the lock file: %w", source, err)
+	}
+	if err := r.verifyArchive(source, archive); err != nil {
+		return nil, err
+	}
+	return loader.LoadArchive(bytes.NewReader(archive.data))
+}
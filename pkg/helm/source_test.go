@@ -0,0 +1,283 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+func TestLoadLockedChart(t *testing.T) {
+	t.Setenv("HELM_REGISTRY_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	archive := testChartArchive(t, "app", "1.0.0")
+	tampered := append(bytes.Clone(archive), 0)
+
+	t.Run("repository", func(t *testing.T) {
+		served := archive
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			switch req.URL.Path {
+			case "/index.yaml":
+				fmt.Fprint(w, "apiVersion: v1\nentries:\n  app:\n  - name: app\n    version: 1.0.0\n    urls: [app-1.0.0.tgz]\n")
+			case "/app-1.0.0.tgz":
+				_, _ = w.Write(served)
+			default:
+				w.WriteHeader(http.StatusNotFound)
+			}
+		}))
+		defer server.Close()
+		source := &ChartSource{Kind: RepositorySource, URL: server.URL, Chart: "app", TLSOptions: &TLSOptions{}}
+
+		lock, err := (&Render{}).LockChart(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := ChartLock{Version: "1.0.0", ArchiveURL: server.URL + "/app-1.0.0.tgz", Digest: digestOf(archive)}
+		if *lock != want {
+			t.Fatalf("lock = %+v, want %+v", *lock, want)
+		}
+		if _, err := (&Render{}).LoadLockedChart(source, lock); err != nil {
+			t.Fatal(err)
+		}
+
+		// The same version published again with another archive.
+		served = tampered
+		_, err = (&Render{}).LoadLockedChart(source, lock)
+		if err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+			t.Errorf("error = %v, want a digest mismatch", err)
+		}
+	})
+
+	t.Run("local archive", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app-1.0.0.tgz")
+		if err := os.WriteFile(path, archive, 0644); err != nil {
+			t.Fatal(err)
+		}
+		source := &ChartSource{Kind: LocalArchiveSource, Path: path, TLSOptions: &TLSOptions{}}
+
+		lock, err := (&Render{}).LockChart(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Local archives are located by their path, which is not locked.
+		want := ChartLock{Version: "1.0.0", Digest: digestOf(archive)}
+		if *lock != want {
+			t.Fatalf("lock = %+v, want %+v", *lock, want)
+		}
+		if _, err := (&Render{}).LoadLockedChart(source, lock); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, tampered, 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err = (&Render{}).LoadLockedChart(source, lock)
+		if err == nil || !strings.Contains(err.Error(), "does not match the lock file") {
+			t.Errorf("error = %v, want a digest mismatch", err)
+		}
+	})
+
+	t.Run("oci", func(t *testing.T) {
+		server := httptest.NewServer(newTestRegistry("", ""))
+		defer server.Close()
+		host := strings.TrimPrefix(server.URL, "http://")
+		opts := &TLSOptions{PlainHTTP: true}
+		client, err := newRegistryClient(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		push := func(data []byte, tag string) {
+			t.Helper()
+			if _, err := client.Push(data, host+"/charts/app:"+tag, registry.PushOptStrictMode(false)); err != nil {
+				t.Fatalf("push: %v", err)
+			}
+		}
+		push(archive, "1.0.0")
+		source := &ChartSource{Kind: OCISource, URL: "oci://" + host + "/charts/app", Version: "^1.0.0", TLSOptions: opts}
+
+		lock, err := (&Render{}).LockChart(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The constraint is pinned to the tag it resolved to.
+		want := ChartLock{Version: "1.0.0", ArchiveURL: "oci://" + host + "/charts/app:1.0.0", Digest: digestOf(archive)}
+		if *lock != want {
+			t.Fatalf("lock = %+v, want %+v", *lock, want)
+		}
+
+		// A newer version matching the constraint is not picked up.
+		push(testChartArchive(t, "app", "1.1.0"), "1.1.0")
+		ch, err := (&Render{}).LoadLockedChart(source, lock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ch.Metadata.Version != "1.0.0" {
+			t.Errorf("loaded version %s, want the locked 1.0.0", ch.Metadata.Version)
+		}
+
+		// The locked tag pushed again with another chart.
+		push(testChartArchive(t, "app", "1.0.0-rebuilt"), "1.0.0")
+		_, err = (&Render{}).LoadLockedChart(source, lock)
+		if err == nil || !strings.Contains(err.Error(), "does not match the lock file") {
+			t.Errorf("error = %v, want a digest mismatch", err)
+		}
+	})
+}
+
+func TestResolveChartSource(t *testing.T) {
+	dir := t.TempDir()
+	for _, file := range []string{"app/Chart.yaml", "app-1.0.0.tgz", "app-1.0.0.tar.gz", "values.yaml"} {
+		path := filepath.Join(dir, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	repositoryConfig := filepath.Join(dir, "repositories.yaml")
+	if err := os.WriteFile(repositoryConfig, []byte(`apiVersion: v1
+repositories:
+- name: stable
+  url: https://charts.example.com/stable
+  username: user
+  password: secret
+  pass_credentials_all: true
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("HELM_REPOSITORY_CONFIG", repositoryConfig)
+	tlsOpts := &TLSOptions{Username: "admin", Password: "admin"}
+
+	tests := []struct {
+		name    string
+		ref     ChartReference
+		want    *ChartSource
+		wantErr string
+	}{
+		{
+			name: "local directory",
+			ref:  ChartReference{Path: filepath.Join(dir, "app")},
+			want: &ChartSource{Kind: LocalDirectorySource, Path: filepath.Join(dir, "app"), TLSOptions: &TLSOptions{}},
+		},
+		{
+			name:    "verified local directory",
+			ref:     ChartReference{Path: filepath.Join(dir, "app"), Verify: true},
+			wantErr: "is a local directory, unpacked charts cannot be verified",
+		},
+		{
+			name: "local archive",
+			ref:  ChartReference{Path: filepath.Join(dir, "app-1.0.0.tgz"), Verify: true, Keyring: "pubring.gpg"},
+			want: &ChartSource{Kind: LocalArchiveSource, Path: filepath.Join(dir, "app-1.0.0.tgz"), TLSOptions: &TLSOptions{}, Verify: true, Keyring: "pubring.gpg"},
+		},
+		{
+			name: "local tar.gz archive",
+			ref:  ChartReference{Path: filepath.Join(dir, "app-1.0.0.tar.gz")},
+			want: &ChartSource{Kind: LocalArchiveSource, Path: filepath.Join(dir, "app-1.0.0.tar.gz"), TLSOptions: &TLSOptions{}},
+		},
+		{
+			name:    "local file",
+			ref:     ChartReference{Path: filepath.Join(dir, "values.yaml")},
+			wantErr: "is neither a local directory nor a local archive (.tgz or .tar.gz)",
+		},
+		{
+			name:    "missing path",
+			ref:     ChartReference{Path: filepath.Join(dir, "missing")},
+			wantErr: "not found: tried local directory and local archive",
+		},
+		{
+			name:    "path and url",
+			ref:     ChartReference{Path: filepath.Join(dir, "app"), URL: "https://charts.example.com/app-1.0.0.tgz"},
+			wantErr: "path and url are mutually exclusive",
+		},
+		{
+			name: "http archive",
+			ref:  ChartReference{URL: "https://charts.example.com/app-1.0.0.tgz", TLSOptions: tlsOpts},
+			want: &ChartSource{Kind: RemoteArchiveSource, URL: "https://charts.example.com/app-1.0.0.tgz", TLSOptions: tlsOpts},
+		},
+		{
+			name: "oci reference",
+			ref:  ChartReference{URL: "oci://registry.example.com/charts/app", Version: "1.0.0"},
+			want: &ChartSource{Kind: OCISource, URL: "oci://registry.example.com/charts/app", Version: "1.0.0", TLSOptions: &TLSOptions{}},
+		},
+		{
+			name: "oci reference and chart",
+			ref:  ChartReference{URL: "oci://registry.example.com/charts/", Chart: "app"},
+			want: &ChartSource{Kind: OCISource, URL: "oci://registry.example.com/charts/app", TLSOptions: &TLSOptions{}},
+		},
+		{
+			name: "oci without scheme",
+			ref:  ChartReference{URL: "registry.example.com/charts", Chart: "app", OCI: true},
+			want: &ChartSource{Kind: OCISource, URL: "oci://registry.example.com/charts/app", TLSOptions: &TLSOptions{}},
+		},
+		{
+			name: "repository url and chart",
+			ref:  ChartReference{URL: "https://charts.example.com", Chart: "app", Version: "^1.0.0"},
+			want: &ChartSource{Kind: RepositorySource, URL: "https://charts.example.com", Chart: "app", Version: "^1.0.0", TLSOptions: &TLSOptions{}},
+		},
+		{
+			name:    "unsupported url",
+			ref:     ChartReference{URL: "ftp://charts.example.com/app-1.0.0.tgz"},
+			wantErr: "not supported: tried oci reference (oci://), repository chart and remote archive (http:// or https://)",
+		},
+		{
+			name: "repository name",
+			ref:  ChartReference{Chart: "stable/app", Version: "1.0.0"},
+			want: &ChartSource{Kind: RepositorySource, URL: "https://charts.example.com/stable", Chart: "app", Version: "1.0.0",
+				TLSOptions: &TLSOptions{Username: "user", Password: "secret", PassCredentials: true}},
+		},
+		{
+			name: "repository name with credentials",
+			ref:  ChartReference{Chart: "stable/app", TLSOptions: tlsOpts},
+			want: &ChartSource{Kind: RepositorySource, URL: "https://charts.example.com/stable", Chart: "app", TLSOptions: tlsOpts},
+		},
+		{
+			name:    "unknown repository name",
+			ref:     ChartReference{Chart: "incubator/app"},
+			wantErr: `tried repository chart, no repository named "incubator" in ` + repositoryConfig,
+		},
+		{
+			name:    "chart without repository",
+			ref:     ChartReference{Chart: "app"},
+			wantErr: "not supported without a path or a url: tried repository chart <repo>/<chart>",
+		},
+		{
+			name:    "no source",
+			ref:     ChartReference{Version: "1.0.0"},
+			wantErr: "no valid helm chart source",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source, err := ResolveChartSource(&tt.ref)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(source, tt.want) {
+				t.Errorf("ResolveChartSource() = %+v, want %+v", source, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveChartSourceWithoutRepositoryConfig(t *testing.T) {
+	repositoryConfig := filepath.Join(t.TempDir(), "repositories.yaml")
+	t.Setenv("HELM_REPOSITORY_CONFIG", repositoryConfig)
+	_, err := ResolveChartSource(&ChartReference{Chart: "stable/app"})
+	want := `chart "stable/app" not found: tried repository chart in ` + repositoryConfig
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("error = %v, want it to contain %q", err, want)
+	}
+}
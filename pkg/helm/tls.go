@@ -0,0 +1,59 @@
+package helm
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSOptions are the TLS and authentication settings used to reach a chart
+// repository or an OCI registry.
+type TLSOptions struct {
+	// CaFile verifies the certificates of the server with this CA bundle.
+	CaFile string
+	// CertFile identifies the client with this SSL certificate file.
+	CertFile string
+	// KeyFile identifies the client with this SSL key file.
+	KeyFile string
+	// Username is the username of the basic authentication.
+	Username string
+	// Password is the password of the basic authentication.
+	Password string
+	// PassCredentials passes the basic authentication credentials to all
+	// domains, e.g. to chart archives served by another host than the repository.
+	PassCredentials bool
+	// InsecureSkipTLSVerify skips the verification of the server certificate.
+	InsecureSkipTLSVerify bool
+	// PlainHTTP reaches OCI registries over plain http instead of https.
+	PlainHTTP bool
+}
+
+// newTLSConfig returns the client TLS config of the options.
+func newTLSConfig(opts *TLSOptions) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: opts.InsecureSkipTLSVerify, //nolint:gosec
+	}
+	if opts.CertFile != "" || opts.KeyFile != "" {
+		if opts.CertFile == "" || opts.KeyFile == "" {
+			return nil, fmt.Errorf("both certFile and keyFile are required for client certificate authentication")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.CertFile, opts.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if opts.CaFile != "" {
+		pem, err := os.ReadFile(opts.CaFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to append certificates from CA file %s", opts.CaFile)
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
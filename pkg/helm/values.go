@@ -0,0 +1,100 @@
+package helm
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/strvals"
+	"sigs.k8s.io/yaml"
+)
+
+// ReadValuesFiles reads the values files in order ("-" means stdin) and deep
+// merges them, later files taking precedence over earlier ones.
+func (r *Render) ReadValuesFiles(valueFiles []string) (map[string]interface{}, error) {
+	providers := getter.All(cli.New())
+	base := map[string]interface{}{}
+	for _, filePath := range valueFiles {
+		data, err := readValuesFile(filePath, providers)
+		if err != nil {
+			return nil, err
+		}
+		current := map[string]interface{}{}
+		if err := yaml.Unmarshal(data, &current); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filePath, err)
+		}
+		base = MergeValues(base, current)
+	}
+	return base, nil
+}
+
+// SetValues applies the --set entries to values in place with Helm strvals semantics.
+func (r *Render) SetValues(values map[string]interface{}, set []string) error {
+	for _, value := range set {
+		if err := strvals.ParseInto(value, values); err != nil {
+			return fmt.Errorf("failed parsing --set data %s: %w", value, err)
+		}
+	}
+	return nil
+}
+
+// MergeValues deep merges src into a copy of dst, values from src taking
+// precedence. Neither input is modified.
+func MergeValues(dst, src map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(dst))
+	for k, v := range dst {
+		out[k] = copyValue(v)
+	}
+	for k, v := range src {
+		if v, ok := v.(map[string]interface{}); ok {
+			if bv, ok := out[k].(map[string]interface{}); ok {
+				out[k] = MergeValues(bv, v)
+				continue
+			}
+		}
+		out[k] = copyValue(v)
+	}
+	return out
+}
+
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return MergeValues(nil, v)
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = copyValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+/////////////// Source: pkg/cli/values/options.go ///////////////////
+
+// readValuesFile load a file from stdin, the local directory, or a remote file with a url.
+func readValuesFile(filePath string, p getter.Providers) ([]byte, error) {
+	if strings.TrimSpace(filePath) == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	u, err := url.Parse(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	g, err := p.ByScheme(u.Scheme)
+	if err != nil {
+		return os.ReadFile(filePath)
+	}
+	data, err := g.Get(filePath, getter.WithURL(filePath))
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), err
+}
@@ -0,0 +1,102 @@
+package helm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/provenance"
+	"helm.sh/helm/v3/pkg/registry"
+	"k8s.io/client-go/util/homedir"
+)
+
+// DefaultKeyring returns the keyring Helm uses by default to verify charts.
+func DefaultKeyring() string {
+	if v, ok := os.LookupEnv("GNUPGHOME"); ok {
+		return filepath.Join(v, "pubring.gpg")
+	}
+	return filepath.Join(homedir.HomeDir(), ".gnupg", "pubring.gpg")
+}
+
+// verifyArchive checks the provenance file of the chart archive against the
+// keyring of the source when verification is enabled.
+func (r *Render) verifyArchive(source *ChartSource, archive *chartArchive) error {
+	if !source.Verify {
+		return nil
+	}
+	var prov []byte
+	var err error
+	name := path.Base(archive.url)
+	switch source.Kind {
+	case LocalArchiveSource:
+		name = filepath.Base(source.Path)
+		prov, err = os.ReadFile(source.Path + ".prov")
+	case RemoteArchiveSource, RepositorySource:
+		prov, err = r.Cache.getProvenance(func() ([]byte, error) {
+			return fetch(archive.url+".prov", source.URL, source.TLSOptions)
+		}, archive.url, digestOf(archive.data))
+	case OCISource:
+		ch, loadErr := loader.LoadArchive(bytes.NewReader(archive.data))
+		if loadErr != nil {
+			return loadErr
+		}
+		// Charts pushed to registries are signed as <name>-<version>.tgz archives.
+		name = fmt.Sprintf("%s-%s.tgz", ch.Metadata.Name, ch.Metadata.Version)
+		prov, err = r.Cache.getProvenance(func() ([]byte, error) {
+			return pullRegistryProvenance(archive.url, source.TLSOptions)
+		}, archive.url, digestOf(archive.data))
+	default:
+		return fmt.Errorf("%s cannot be verified", source)
+	}
+	if err != nil {
+		return fmt.Errorf("could not load the provenance file of %s: %w", source, err)
+	}
+	if err := verifyProvenance(archive.data, prov, name, source.Keyring); err != nil {
+		return fmt.Errorf("failed to verify %s: %w", source, err)
+	}
+	return nil
+}
+
+// pullRegistryProvenance pulls the provenance layer of the oci:// reference.
+func pullRegistryProvenance(ref string, opts *TLSOptions) ([]byte, error) {
+	client, err := newRegistryClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	result, err := client.Pull(ref, registry.PullOptWithChart(false), registry.PullOptWithProv(true))
+	if err != nil {
+		return nil, err
+	}
+	return result.Prov.Data, nil
+}
+
+// verifyProvenance verifies the signature of the provenance file prov with the
+// keyring, the DefaultKeyring when empty, and checks that it records the
+// digest of the archive data named name.
+func verifyProvenance(data, prov []byte, name, keyring string) error {
+	if keyring == "" {
+		keyring = DefaultKeyring()
+	}
+	dir, err := os.MkdirTemp("", "helm-kcl-verify-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	// The provenance file records the digest of the archive by file name.
+	chartPath := filepath.Join(dir, name)
+	if err := os.WriteFile(chartPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(chartPath+".prov", prov, 0600); err != nil {
+		return err
+	}
+	sig, err := provenance.NewFromKeyring(keyring, "")
+	if err != nil {
+		return fmt.Errorf("failed to load keyring %s: %w", keyring, err)
+	}
+	_, err = sig.Verify(chartPath, chartPath+".prov")
+	return err
+}
@@ -0,0 +1,120 @@
+package helm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The signed chart and the keys come from the testdata of helm.sh/helm/v3/pkg/provenance.
+const (
+	signedChartArchive = "testdata/hashtest-1.2.3.tgz"
+	trustedKeyring     = "testdata/helm-test-key.pub"
+	untrustedKeyring   = "testdata/helm-password-key.secret"
+)
+
+func readTestFile(t *testing.T, file string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestVerifyLocalArchive(t *testing.T) {
+	archive := readTestFile(t, signedChartArchive)
+	prov := readTestFile(t, signedChartArchive+".prov")
+	tampered := append(append([]byte{}, archive...), 0)
+	tests := []struct {
+		name    string
+		archive []byte
+		prov    []byte
+		keyring string
+		wantErr string
+	}{
+		{name: "signed", archive: archive, prov: prov, keyring: trustedKeyring},
+		{name: "missing provenance", archive: archive, keyring: trustedKeyring, wantErr: "could not load the provenance file"},
+		{name: "tampered archive", archive: tampered, prov: prov, keyring: trustedKeyring, wantErr: "sha256 sum does not match"},
+		{name: "untrusted key", archive: archive, prov: prov, keyring: untrustedKeyring, wantErr: "failed to verify"},
+		{name: "missing keyring", archive: archive, prov: prov, keyring: "testdata/missing.gpg", wantErr: "failed to load keyring"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), filepath.Base(signedChartArchive))
+			if err := os.WriteFile(path, tt.archive, 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.prov != nil {
+				if err := os.WriteFile(path+".prov", tt.prov, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			source := &ChartSource{Kind: LocalArchiveSource, Path: path, Verify: true, Keyring: tt.keyring}
+			err := (&Render{}).verifyArchive(source, &chartArchive{data: tt.archive, url: path})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRemoteArchiveDefaultKeyring(t *testing.T) {
+	// Without keyring, e.g. with helm kcl lock, the default keyring is used.
+	gnupgHome := t.TempDir()
+	if err := os.WriteFile(filepath.Join(gnupgHome, "pubring.gpg"), readTestFile(t, trustedKeyring), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GNUPGHOME", gnupgHome)
+
+	files := map[string][]byte{
+		"/hashtest-1.2.3.tgz":      readTestFile(t, signedChartArchive),
+		"/hashtest-1.2.3.tgz.prov": readTestFile(t, signedChartArchive+".prov"),
+		"/unsigned-1.2.3.tgz":      readTestFile(t, signedChartArchive),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, ok := files[req.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		url     string
+		wantErr string
+	}{
+		{name: "signed", url: server.URL + "/hashtest-1.2.3.tgz"},
+		{name: "missing provenance", url: server.URL + "/unsigned-1.2.3.tgz", wantErr: "could not load the provenance file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &ChartSource{Kind: RemoteArchiveSource, URL: tt.url, TLSOptions: &TLSOptions{}, Verify: true}
+			lock, err := (&Render{}).LockChart(source)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if lock.Version != "1.2.3" {
+					t.Errorf("locked version %q, want 1.2.3", lock.Version)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}